@@ -0,0 +1,28 @@
+package contract
+
+import "encoding/json"
+
+// ResultVersion версия результатов, в которую пишет команда: 0 для всех команд, кроме replay
+func (c Command) ResultVersion() int {
+	if c.Replay == nil {
+		return 0
+	}
+	return c.Replay.ResultVersion
+}
+
+// MarshalJSON отправляет команду с текущей версией формата
+func (c Command) MarshalJSON() ([]byte, error) {
+	type plain Command
+	c.SchemaVersion = SchemaVersion
+	return json.Marshal(plain(c))
+}
+
+// UnmarshalJSON принимает команды текущей и прежних версий. Команды версии 0 отличаются только
+// отсутствием schema_version: ID строки outbox они уже несли, а лишнее поле processed_at игнорируется
+func (c *Command) UnmarshalJSON(data []byte) error {
+	type plain Command
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	return checkVersion(c.SchemaVersion)
+}
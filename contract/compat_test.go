@@ -0,0 +1,147 @@
+package contract
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Типы, которыми сообщения читают уже выпущенные версии сервисов. Они заморожены и не меняются вместе
+// с контрактом: тесты ниже проверяют, что сообщения текущей версии понимают получатели, обновлённые раньше.
+// Heartbeats версии 0 читал оркестратор с полями в стиле Go, heartbeats версии 1 ему непонятны,
+// поэтому оркестраторы обновляются раньше раннеров и отдельного получателя версии 0 для heartbeats нет
+
+// runnerV0Command команда, как её читали раннеры до появления контракта
+type runnerV0Command struct {
+	ScenarioID  string `json:"scenario_id"`
+	Action      string `json:"action"`
+	VideoSource string `json:"video_source"`
+}
+
+// v1Command команда версии 1
+type v1Command struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"`
+	ScenarioID    string    `json:"scenario_id"`
+	Action        string    `json:"action"`
+	VideoSource   string    `json:"video_source"`
+	CreatedAt     time.Time `json:"created_at"`
+	Frames        []int64   `json:"frames"`
+	Replay        *struct {
+		FromFrame     int64 `json:"from_frame"`
+		ToFrame       int64 `json:"to_frame"`
+		ResultVersion int   `json:"result_version"`
+	} `json:"replay"`
+}
+
+// v1Heartbeat heartbeat версии 1
+type v1Heartbeat struct {
+	SchemaVersion int       `json:"schema_version"`
+	ScenarioID    string    `json:"scenario_id"`
+	Action        string    `json:"action"`
+	Frame         int64     `json:"frame"`
+	TimeStamp     time.Time `json:"timestamp"`
+	FailedFrames  []struct {
+		Frame    int64  `json:"frame"`
+		Error    string `json:"error"`
+		Attempts int    `json:"attempts"`
+	} `json:"failed_frames"`
+	RecoveredFrames []int64 `json:"recovered_frames"`
+	TotalFrames     int64   `json:"total_frames"`
+	FPS             float64 `json:"fps"`
+}
+
+// v0DetectionResult результат детекции, как его читали потребители топика результатов до появления контракта
+type v0DetectionResult struct {
+	ScenarioID  string    `json:"scenario_id"`
+	Frame       int       `json:"frame"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Model       struct {
+		Name string `json:"name"`
+	} `json:"model"`
+	Detections []struct {
+		Class string    `json:"class"`
+		Score float64   `json:"score"`
+		Box   []float64 `json:"box"`
+	} `json:"detections"`
+}
+
+// v1DetectionResult результат детекции версии 1
+type v1DetectionResult struct {
+	SchemaVersion  int        `json:"schema_version"`
+	ScenarioID     string     `json:"scenario_id"`
+	Frame          int        `json:"frame"`
+	FrameTimestamp *time.Time `json:"frame_timestamp"`
+	ProcessedAt    time.Time  `json:"processed_at"`
+	Model          struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"model"`
+	Detections []struct {
+		Class string    `json:"class"`
+		Score float64   `json:"score"`
+		Box   []float64 `json:"box"`
+	} `json:"detections"`
+	ResultVersion int `json:"result_version"`
+}
+
+// TestOlderReadersDecodeCurrentMessages сообщения, отправленные текущим кодом, читаются прежними получателями
+func TestOlderReadersDecodeCurrentMessages(t *testing.T) {
+	messages := make(map[string][]byte)
+	for _, msg := range version1Messages() {
+		data, err := json.Marshal(msg.value)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", msg.golden, err)
+		}
+		messages[msg.golden] = data
+	}
+
+	// Ожидаемое содержимое задано через frozen файлы версии 1: их разбирает тот же тип, что и новое сообщение
+	tests := []struct {
+		name    string
+		message string
+		reader  func() any
+	}{
+		{name: "runner v0 command", message: "command_v1.json", reader: func() any { return new(runnerV0Command) }},
+		{name: "v1 command", message: "command_v1.json", reader: func() any { return new(v1Command) }},
+		{name: "v1 heartbeat", message: "heartbeat_v1.json", reader: func() any { return new(v1Heartbeat) }},
+		{name: "v0 result", message: "result_v1.json", reader: func() any { return new(v0DetectionResult) }},
+		{name: "v1 result", message: "result_v1.json", reader: func() any { return new(v1DetectionResult) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := tt.reader(), tt.reader()
+			if err := json.Unmarshal(messages[tt.message], got); err != nil {
+				t.Fatalf("decode current message: %v", err)
+			}
+			if err := json.Unmarshal(readGolden(t, "frozen/"+tt.message), want); err != nil {
+				t.Fatalf("decode frozen message: %v", err)
+			}
+			if reflect.ValueOf(want).Elem().IsZero() {
+				t.Fatal("frozen message decoded into an empty value")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestRunnerV0Command раннеры до появления контракта получают из команды всё, что им нужно
+func TestRunnerV0Command(t *testing.T) {
+	data, err := json.Marshal(Command{ScenarioID: scenarioID, Action: CommandStart, VideoSource: "frames/" + scenarioID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got runnerV0Command
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := runnerV0Command{ScenarioID: scenarioID, Action: "start", VideoSource: "frames/" + scenarioID}
+	if got != want {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
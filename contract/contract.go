@@ -0,0 +1,35 @@
+// Package contract сообщения Kafka между оркестратором и раннерами. Оба сервиса используют
+// эти типы, поэтому формат сообщений описан в одном месте.
+//
+// Каждое сообщение несёт schema_version. Версия увеличивается только при несовместимом изменении
+// формата: новое необязательное поле добавляется без смены версии, прежние получатели его игнорируют.
+// Сообщения без schema_version (версия 0) отправлялись до появления контракта и по-прежнему принимаются.
+//
+// Порядок обновления: сначала оркестраторы, затем раннеры. Команды версии 1 понимают и раннеры версии 0,
+// а heartbeats версии 1 (поля в snake_case) оркестратор версии 0 не разбирает: его watchdog счёл бы
+// обновлённые раннеры пропавшими и перезапускал их сценарии.
+//
+// Формат сообщений описан JSON Schema в каталоге schema, типы Go генерируются из неё в types_gen.go.
+// Методы сообщений и разбор прежних версий написаны вручную
+package contract
+
+//go:generate go run ./internal/schemagen -out types_gen.go schema/command.schema.json schema/heartbeat.schema.json schema/detection_result.schema.json
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion текущая версия формата сообщений
+const SchemaVersion = 1
+
+// ErrUnsupportedVersion сообщение отправлено более новой версией сервиса, чем получатель
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// checkVersion отклоняет сообщения версий, о которых получатель ещё не знает
+func checkVersion(version int) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: %d, supported up to %d", ErrUnsupportedVersion, version, SchemaVersion)
+	}
+	return nil
+}
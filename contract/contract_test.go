@@ -0,0 +1,197 @@
+package contract
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files of the current schema version")
+
+const scenarioID = "b3a9d2f0-5c61-4e8a-8f47-2d9e1c6b0a35"
+
+var (
+	createdAt   = time.Date(2025, 3, 14, 9, 26, 53, 589793000, time.UTC)
+	processedAt = time.Date(2025, 3, 14, 9, 27, 3, 500000000, time.UTC)
+)
+
+// TestDecodeVersion0 сообщения, которые отправляли сервисы до появления контракта:
+// команды оркестратора раннерам, heartbeats раннеров оркестратору и результаты детекции
+func TestDecodeVersion0(t *testing.T) {
+	tests := []struct {
+		golden string
+		got    any
+		want   any
+	}{
+		{
+			golden: "command_v0.json",
+			got:    new(Command),
+			want: &Command{
+				ID:          "6f1c2a4e-1b7d-4c39-9a55-0d2f3e8b7c10",
+				ScenarioID:  scenarioID,
+				Action:      CommandStart,
+				VideoSource: "frames/" + scenarioID,
+				CreatedAt:   createdAt,
+			},
+		},
+		{
+			golden: "heartbeat_v0.json",
+			got:    new(Heartbeat),
+			want: &Heartbeat{
+				ScenarioID: scenarioID,
+				Action:     CommandStart,
+				Frame:      41,
+				TimeStamp:  processedAt,
+			},
+		},
+		{
+			golden: "result_v0.json",
+			got:    new(DetectionResult),
+			want: &DetectionResult{
+				ScenarioID:  scenarioID,
+				Frame:       41,
+				ProcessedAt: processedAt,
+				Model:       ModelInfo{Name: "yolov8n"},
+				Detections:  []Detection{{Class: "person", Score: 0.91, Box: []float64{12, 34, 56, 78}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			if err := json.Unmarshal(readGolden(t, tt.golden), tt.got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("decoded %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+// version1Messages сообщения версии 1 и имена их golden файлов
+func version1Messages() []struct {
+	golden string
+	value  any
+	got    any
+} {
+	frameTimestamp := processedAt.Add(-time.Second)
+	return []struct {
+		golden string
+		value  any
+		got    any
+	}{
+		{
+			golden: "command_v1.json",
+			value: &Command{
+				ID:          "6f1c2a4e-1b7d-4c39-9a55-0d2f3e8b7c10",
+				ScenarioID:  scenarioID,
+				Action:      CommandReplay,
+				VideoSource: "frames/" + scenarioID,
+				CreatedAt:   createdAt,
+				Replay:      &ReplayRange{FromFrame: 10, ToFrame: -1, ResultVersion: 2},
+			},
+			got: new(Command),
+		},
+		{
+			golden: "heartbeat_v1.json",
+			value: &Heartbeat{
+				ScenarioID:      scenarioID,
+				Action:          CommandStart,
+				Frame:           41,
+				TimeStamp:       processedAt,
+				FailedFrames:    []FrameFailure{{Frame: 7, Error: "detection timeout", Attempts: 5}},
+				RecoveredFrames: []int64{3},
+				TotalFrames:     120,
+				FPS:             4.5,
+			},
+			got: new(Heartbeat),
+		},
+		{
+			golden: "result_v1.json",
+			value: &DetectionResult{
+				ScenarioID:     scenarioID,
+				Frame:          41,
+				FrameTimestamp: &frameTimestamp,
+				ProcessedAt:    processedAt,
+				Model:          ModelInfo{Name: "yolov8n", Version: "8.1"},
+				Detections:     []Detection{{Class: "person", Score: 0.91, Box: []float64{12, 34, 56, 78}}},
+				ResultVersion:  2,
+			},
+			got: new(DetectionResult),
+		},
+	}
+}
+
+// TestCurrentVersionRoundTrip сообщения текущей версии кодируются в golden файлы и декодируются обратно без потерь
+func TestCurrentVersionRoundTrip(t *testing.T) {
+	for _, tt := range version1Messages() {
+		t.Run(tt.golden, func(t *testing.T) {
+			data, err := json.MarshalIndent(tt.value, "", "  ")
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			data = append(data, '\n')
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			golden := readGolden(t, tt.golden)
+			if string(data) != string(golden) {
+				t.Errorf("encoded\n%s\nwant\n%s", data, golden)
+			}
+
+			if err := json.Unmarshal(golden, tt.got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			// Получатель видит версию, с которой сообщение отправлено
+			reflect.ValueOf(tt.value).Elem().FieldByName("SchemaVersion").SetInt(SchemaVersion)
+			if !reflect.DeepEqual(tt.got, tt.value) {
+				t.Errorf("decoded %+v, want %+v", tt.got, tt.value)
+			}
+		})
+	}
+}
+
+// TestDecodeFrozenVersion1 сообщения версии 1, уже отправленные работающими сервисами, читаются текущим кодом.
+// Файлы testdata/frozen не перезаписываются -update: изменение формата, которое ломает их разбор, несовместимо
+func TestDecodeFrozenVersion1(t *testing.T) {
+	for _, tt := range version1Messages() {
+		t.Run(tt.golden, func(t *testing.T) {
+			if err := json.Unmarshal(readGolden(t, filepath.Join("frozen", tt.golden)), tt.got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			reflect.ValueOf(tt.value).Elem().FieldByName("SchemaVersion").SetInt(1)
+			if !reflect.DeepEqual(tt.got, tt.value) {
+				t.Errorf("decoded %+v, want %+v", tt.got, tt.value)
+			}
+		})
+	}
+}
+
+func TestRejectNewerVersion(t *testing.T) {
+	data := []byte(`{"schema_version": 2, "scenario_id": "` + scenarioID + `"}`)
+	for _, msg := range []any{new(Command), new(Heartbeat), new(DetectionResult)} {
+		if err := json.Unmarshal(data, msg); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("%T: got error %v, want %v", msg, err, ErrUnsupportedVersion)
+		}
+	}
+}
+
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,3 @@
+module github.com/Capitan-Parrot/distributed-video-system/contract
+
+go 1.24.0
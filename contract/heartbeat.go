@@ -0,0 +1,66 @@
+package contract
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HasProgress сообщает, несёт ли heartbeat прогресс обработки.
+// Подтверждения запуска и остановки сценария отправляются без него
+func (h Heartbeat) HasProgress() bool {
+	return h.TotalFrames > 0 || h.FPS > 0
+}
+
+// ProcessedFrames число обработанных кадров: heartbeat работающего сценария несёт индекс
+// последнего обработанного кадра, а heartbeat остановки и паузы - индекс следующего
+func (h Heartbeat) ProcessedFrames() int64 {
+	if h.Action == CommandStart {
+		return h.Frame + 1
+	}
+	return h.Frame
+}
+
+// MarshalJSON отправляет heartbeat с текущей версией формата
+func (h Heartbeat) MarshalJSON() ([]byte, error) {
+	type plain Heartbeat
+	h.SchemaVersion = SchemaVersion
+	return json.Marshal(plain(h))
+}
+
+// UnmarshalJSON принимает heartbeats текущей версии и версии 0 с полями в стиле Go
+func (h *Heartbeat) UnmarshalJSON(data []byte) error {
+	var version struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return err
+	}
+
+	if version.SchemaVersion == nil {
+		var legacy legacyHeartbeat
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		*h = Heartbeat(legacy)
+		return nil
+	}
+
+	type plain Heartbeat
+	if err := json.Unmarshal(data, (*plain)(h)); err != nil {
+		return err
+	}
+	return checkVersion(h.SchemaVersion)
+}
+
+// legacyHeartbeat heartbeat версии 0, который отправляли раннеры до появления контракта
+type legacyHeartbeat struct {
+	SchemaVersion   int            `json:"-"`
+	ScenarioID      string         `json:"ScenarioID"`
+	Action          CommandAction  `json:"Action"`
+	Frame           int64          `json:"Frame"`
+	TimeStamp       time.Time      `json:"TimeStamp"`
+	FailedFrames    []FrameFailure `json:"FailedFrames"`
+	RecoveredFrames []int64        `json:"RecoveredFrames"`
+	TotalFrames     int64          `json:"TotalFrames"`
+	FPS             float64        `json:"FPS"`
+}
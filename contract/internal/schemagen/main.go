@@ -0,0 +1,276 @@
+// schemagen генерирует Go типы сообщений контракта из JSON Schema:
+//
+//	go run ./internal/schemagen -out types_gen.go schema/command.schema.json ...
+//
+// Поддерживается подмножество JSON Schema, которое используют схемы контракта: объекты,
+// строковые перечисления, массивы и ссылки на $defs, в том числе из соседних файлов схем.
+// Имя типа сообщения берётся из title, имена вложенных типов - из ключей $defs,
+// документация - из description. Расширения схемы:
+//   - x-go-name имя поля, если оно не получается из имени свойства;
+//   - x-go-type тип целого числа, по умолчанию int64;
+//   - x-enum-names и x-enum-descriptions имена и описания констант перечисления.
+//
+// Необязательные свойства получают omitempty, а необязательные объекты и время - указатель
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// schema узел JSON Schema
+type schema struct {
+	Ref         string   `json:"$ref"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Format      string   `json:"format"`
+	Enum        []string `json:"enum"`
+	EnumNames   []string `json:"x-enum-names"`
+	EnumDocs    []string `json:"x-enum-descriptions"`
+	GoName      string   `json:"x-go-name"`
+	GoType      string   `json:"x-go-type"`
+	Items       *schema  `json:"items"`
+	Properties  members  `json:"properties"`
+	Required    []string `json:"required"`
+	Defs        members  `json:"$defs"`
+}
+
+// members объект JSON с сохранением порядка ключей: в нём же порядке генерируются типы и поля
+type members []member
+
+type member struct {
+	name   string
+	schema *schema
+}
+
+func (m *members) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("expected object, got %v", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var s schema
+		if err := dec.Decode(&s); err != nil {
+			return err
+		}
+		*m = append(*m, member{name: tok.(string), schema: &s})
+	}
+
+	_, err := dec.Token()
+	return err
+}
+
+// initialisms части имён свойств, которые пишутся в Go заглавными буквами
+var initialisms = map[string]string{"id": "ID", "fps": "FPS"}
+
+func main() {
+	out := flag.String("out", "types_gen.go", "output file")
+	flag.Parse()
+
+	src, err := generate(flag.Args())
+	if err != nil {
+		log.Fatalf("schemagen: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("schemagen: %v", err)
+	}
+}
+
+// generate возвращает отформатированный исходный код типов, описанных файлами схем
+func generate(files []string) ([]byte, error) {
+	type typeDef struct {
+		name   string
+		schema *schema
+	}
+
+	var defs []typeDef
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var root schema
+		if err := json.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if root.Title == "" {
+			return nil, fmt.Errorf("%s: title is required", file)
+		}
+
+		defs = append(defs, typeDef{root.Title, &root})
+		for _, def := range root.Defs {
+			defs = append(defs, typeDef{def.name, def.schema})
+		}
+		names = append(names, filepath.Base(file))
+	}
+
+	g := &generator{objects: make(map[string]bool)}
+	for _, def := range defs {
+		if _, ok := g.objects[def.name]; ok {
+			return nil, fmt.Errorf("type %s is defined twice", def.name)
+		}
+		g.objects[def.name] = def.schema.Type == "object"
+	}
+
+	var body bytes.Buffer
+	for _, def := range defs {
+		var err error
+		switch {
+		case def.schema.Type == "object":
+			err = g.object(&body, def.name, def.schema)
+		case def.schema.Type == "string" && len(def.schema.Enum) > 0:
+			err = g.enum(&body, def.name, def.schema)
+		default:
+			err = fmt.Errorf("unsupported type %q", def.schema.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", def.name, err)
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by schemagen from %s. DO NOT EDIT.\n\npackage contract\n", strings.Join(names, ", "))
+	if g.time {
+		src.WriteString("\nimport \"time\"\n")
+	}
+	src.Write(body.Bytes())
+
+	return format.Source(src.Bytes())
+}
+
+type generator struct {
+	// objects известные типы, true для объектов
+	objects map[string]bool
+	// time сгенерированный код использует time.Time
+	time bool
+}
+
+func (g *generator) object(w *bytes.Buffer, name string, s *schema) error {
+	fmt.Fprintf(w, "\n%stype %s struct {\n", doc(name, s.Description), name)
+	for _, p := range s.Properties {
+		required := slices.Contains(s.Required, p.name)
+		typ, err := g.goType(p.schema, required)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", p.name, err)
+		}
+
+		tag := p.name
+		if !required {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(w, "\t%s %s `json:\"%s\"`", fieldName(p.name, p.schema), typ, tag)
+		if p.schema.Description != "" {
+			fmt.Fprintf(w, " // %s", p.schema.Description)
+		}
+		w.WriteString("\n")
+	}
+	w.WriteString("}\n")
+
+	return nil
+}
+
+func (g *generator) enum(w *bytes.Buffer, name string, s *schema) error {
+	if len(s.EnumNames) != len(s.Enum) {
+		return fmt.Errorf("x-enum-names must name every enum value")
+	}
+
+	fmt.Fprintf(w, "\n%stype %s string\n\nconst (\n", doc(name, s.Description), name)
+	for i, value := range s.Enum {
+		if i < len(s.EnumDocs) && s.EnumDocs[i] != "" {
+			fmt.Fprintf(w, "\t%s", doc(s.EnumNames[i], s.EnumDocs[i]))
+		}
+		fmt.Fprintf(w, "\t%s %s = %q\n", s.EnumNames[i], name, value)
+	}
+	w.WriteString(")\n")
+
+	return nil
+}
+
+// goType тип поля. Необязательные объекты и время передаются указателем, чтобы отличать отсутствие значения
+func (g *generator) goType(s *schema, required bool) (string, error) {
+	if s.Ref != "" {
+		name := s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+		object, ok := g.objects[name]
+		if !ok {
+			return "", fmt.Errorf("unknown reference %s", s.Ref)
+		}
+		if object && !required {
+			return "*" + name, nil
+		}
+		return name, nil
+	}
+
+	switch s.Type {
+	case "string":
+		if s.Format != "date-time" {
+			return "string", nil
+		}
+		g.time = true
+		if !required {
+			return "*time.Time", nil
+		}
+		return "time.Time", nil
+	case "integer":
+		if s.GoType != "" {
+			return s.GoType, nil
+		}
+		return "int64", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		item, err := g.goType(s.Items, true)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	}
+
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// fieldName имя поля Go для свойства в snake_case
+func fieldName(property string, s *schema) string {
+	if s.GoName != "" {
+		return s.GoName
+	}
+
+	var name strings.Builder
+	for _, part := range strings.Split(property, "_") {
+		if initialism, ok := initialisms[part]; ok {
+			name.WriteString(initialism)
+		} else if part != "" {
+			name.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return name.String()
+}
+
+// doc комментарий к объявлению name в стиле остального контракта
+func doc(name, description string) string {
+	if description == "" {
+		return ""
+	}
+	return fmt.Sprintf("// %s %s\n", name, description)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGeneratedTypesUpToDate types_gen.go должен совпадать с тем, что генерируется из текущих схем
+func TestGeneratedTypesUpToDate(t *testing.T) {
+	root := filepath.Join("..", "..")
+	src, err := os.ReadFile(filepath.Join(root, "contract.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Файлы схем берутся из директивы go:generate, чтобы тест проверял то же, что запускает go generate
+	var files []string
+	for _, line := range strings.Split(string(src), "\n") {
+		args, ok := strings.CutPrefix(line, "//go:generate go run ./internal/schemagen ")
+		if !ok {
+			continue
+		}
+		for _, arg := range strings.Fields(args) {
+			if strings.HasSuffix(arg, ".schema.json") {
+				files = append(files, filepath.Join(root, arg))
+			}
+		}
+	}
+	if len(files) == 0 {
+		t.Fatal("go:generate directive for schemagen not found in contract.go")
+	}
+
+	got, err := generate(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join(root, "types_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Error("types_gen.go is out of date, run go generate in the contract module")
+	}
+}
@@ -0,0 +1,19 @@
+package contract
+
+import "encoding/json"
+
+// MarshalJSON отправляет результат с текущей версией формата
+func (r DetectionResult) MarshalJSON() ([]byte, error) {
+	type plain DetectionResult
+	r.SchemaVersion = SchemaVersion
+	return json.Marshal(plain(r))
+}
+
+// UnmarshalJSON отклоняет результаты неизвестных получателю версий
+func (r *DetectionResult) UnmarshalJSON(data []byte) error {
+	type plain DetectionResult
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	return checkVersion(r.SchemaVersion)
+}
@@ -1,10 +1,17 @@
 from PIL import ImageFile
 import time
+import ultralytics
 from ultralytics import YOLO
 
 
 model = YOLO('yolov8n.pt')
 
+# Модель, которой обработан кадр, возвращается вместе с детекциями
+MODEL_INFO = {
+    'name': 'yolov8n',
+    'version': ultralytics.__version__,
+}
+
 
 def predict(image: ImageFile.ImageFile) -> list[dict]:
     results = model.predict(source=image, imgsz=320, conf=0.1)
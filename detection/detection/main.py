@@ -4,7 +4,7 @@ from fastapi.responses import JSONResponse
 from PIL import Image
 import io
 
-from detection.detect import predict
+from detection.detect import predict, MODEL_INFO
 
 app = FastAPI()
 
@@ -25,7 +25,7 @@ async def infer_image(file: UploadFile = File(...)):
     except Exception as e:
         raise HTTPException(status_code=500, detail=f"Inference error: {e}")
 
-    return JSONResponse(content={"detections": detections})
+    return JSONResponse(content={"detections": detections, "model": MODEL_INFO})
 
 
 @app.get("/health")
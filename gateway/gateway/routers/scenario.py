@@ -1,12 +1,10 @@
-import json
-
-from botocore.exceptions import ClientError
-from fastapi import APIRouter, HTTPException, UploadFile, File
+from fastapi import APIRouter, HTTPException, UploadFile, File, Form, Request
+from fastapi.responses import StreamingResponse
+from typing import Optional
 from uuid import UUID
 import httpx
 
-from gateway.clients.s3 import s3Client
-from gateway.config import ORCHESTRATOR_URL, S3_BUCKET
+from gateway.config import ORCHESTRATOR_URL
 from gateway.schemas.scenario import ScenarioAction
 
 router = APIRouter()
@@ -24,12 +22,57 @@ def parse_httpx_error(e: httpx.HTTPStatusError) -> HTTPException:
 
 
 @router.post("/scenario/")
-async def initialize_scenario(video: UploadFile = File(...)):
+async def initialize_scenario(
+    video: UploadFile = File(...),
+    fps: Optional[float] = Form(None),
+    quality: Optional[int] = Form(None),
+    max_width: Optional[int] = Form(None),
+    max_height: Optional[int] = Form(None),
+    start: Optional[float] = Form(None),
+    end: Optional[float] = Form(None),
+):
     try:
         file_bytes = await video.read()
         files = {"video": (video.filename, file_bytes, video.content_type)}
+        # Настройки извлечения кадров, незаданные поля оркестратор заполнит по умолчанию
+        options = {
+            "fps": fps,
+            "quality": quality,
+            "max_width": max_width,
+            "max_height": max_height,
+            "start": start,
+            "end": end,
+        }
+        data = {k: str(v) for k, v in options.items() if v is not None}
+
+        resp = await client.post(f"{ORCHESTRATOR_URL}/scenario", files=files, data=data)
+        resp.raise_for_status()
+    except httpx.HTTPStatusError as e:
+        raise parse_httpx_error(e)
+    except httpx.HTTPError as e:
+        raise HTTPException(status_code=500, detail=f"Orchestrator HTTPError: {e}")
+    return resp.json()
+
+
+@router.get("/scenario/")
+async def list_scenarios(request: Request):
+    try:
+        # Фильтры и курсор передаются оркестратору как есть
+        resp = await client.get(
+            f"{ORCHESTRATOR_URL}/scenario", params=request.query_params
+        )
+        resp.raise_for_status()
+    except httpx.HTTPStatusError as e:
+        raise parse_httpx_error(e)
+    except httpx.HTTPError as e:
+        raise HTTPException(status_code=500, detail=f"Orchestrator HTTPError: {e}")
+    return resp.json()
+
 
-        resp = await client.post(f"{ORCHESTRATOR_URL}/scenario", files=files)
+@router.get("/scenario/{scenario_id}/history")
+async def get_scenario_history(scenario_id: UUID):
+    try:
+        resp = await client.get(f"{ORCHESTRATOR_URL}/scenario/{scenario_id}/history")
         resp.raise_for_status()
     except httpx.HTTPStatusError as e:
         raise parse_httpx_error(e)
@@ -51,11 +94,28 @@ async def get_scenario_status(scenario_id: UUID):
 
 
 @router.post("/scenario/{scenario_id}/")
-async def change_scenario_status(scenario_id: UUID, action: ScenarioAction):
+async def change_scenario_status(
+    scenario_id: UUID,
+    action: ScenarioAction,
+    from_frame: Optional[int] = None,
+    to_frame: Optional[int] = None,
+    from_time: Optional[float] = None,
+    to_time: Optional[float] = None,
+):
+    # Диапазон кадров или времени нужен только для replay
+    replay_range = {
+        "from_frame": from_frame,
+        "to_frame": to_frame,
+        "from_time": from_time,
+        "to_time": to_time,
+    }
+    params = {"action": action.value}
+    params.update({k: str(v) for k, v in replay_range.items() if v is not None})
+
     try:
         resp = await client.post(
             f"{ORCHESTRATOR_URL}/scenario/{scenario_id}",
-            params={"action": action.value},
+            params=params,
         )
         resp.raise_for_status()
     except httpx.HTTPStatusError as e:
@@ -65,55 +125,68 @@ async def change_scenario_status(scenario_id: UUID, action: ScenarioAction):
     return resp.json()
 
 
-@router.get("/prediction/{scenario_id}/")
-async def get_predictions(scenario_id: UUID):
+@router.delete("/scenario/{scenario_id}/", status_code=202)
+async def delete_scenario(scenario_id: UUID):
+    try:
+        resp = await client.delete(f"{ORCHESTRATOR_URL}/scenario/{scenario_id}")
+        resp.raise_for_status()
+    except httpx.HTTPStatusError as e:
+        raise parse_httpx_error(e)
+    except httpx.HTTPError as e:
+        raise HTTPException(status_code=500, detail=f"Orchestrator HTTPError: {e}")
+    return resp.json()
+
+
+@router.get("/scenario/{scenario_id}/predictions/stream")
+async def stream_predictions(scenario_id: UUID, request: Request):
+    headers = {}
+    if "last-event-id" in request.headers:
+        headers["Last-Event-ID"] = request.headers["last-event-id"]
+
+    # Поток бесконечный, поэтому без таймаута на чтение
+    req = client.build_request(
+        "GET",
+        f"{ORCHESTRATOR_URL}/scenario/{scenario_id}/predictions/stream",
+        params=request.query_params,
+        headers=headers,
+        timeout=httpx.Timeout(30.0, read=None),
+    )
     try:
-        folder_prefix = f"{str(scenario_id)}/"
-        results = []
+        resp = await client.send(req, stream=True)
+        if resp.is_error:
+            await resp.aread()
+            await resp.aclose()
+            resp.raise_for_status()
+    except httpx.HTTPStatusError as e:
+        raise parse_httpx_error(e)
+    except httpx.HTTPError as e:
+        raise HTTPException(status_code=500, detail=f"Orchestrator HTTPError: {e}")
+
+    async def events():
+        try:
+            async for chunk in resp.aiter_raw():
+                yield chunk
+        finally:
+            await resp.aclose()
+
+    return StreamingResponse(
+        events(),
+        media_type="text/event-stream",
+        headers={"Cache-Control": "no-cache"},
+    )
 
-        # Получаем список объектов в папке
-        objects = s3Client.list_objects_v2(
-            Bucket=S3_BUCKET, Prefix=folder_prefix, Delimiter="/"
-        )
 
-        if "Contents" not in objects:
-            raise HTTPException(
-                status_code=404, detail="No predictions found for this scenario"
-            )
-
-        # Обрабатываем каждый файл
-        for obj in objects["Contents"]:
-            if obj["Key"].endswith("/"):
-                continue
-
-            file_key = obj["Key"]
-            try:
-                response = s3Client.get_object(Bucket=S3_BUCKET, Key=file_key)
-                file_content = response["Body"].read().decode("utf-8")
-                results.append(
-                    {
-                        "frame": file_key.split("/")[1],
-                        "predictions": json.loads(file_content),
-                    }
-                )
-            except ClientError:
-                continue
-            except json.JSONDecodeError:
-                continue
-
-        if not results:
-            raise HTTPException(
-                status_code=404, detail="No valid prediction files found"
-            )
-
-        results.sort(key=lambda name: int(name["frame"].split(".")[0]))
-
-        return {"scenario_id": str(scenario_id), "results": results}
-    except HTTPException:
-        raise
-    except ClientError as e:
-        if e.response["Error"]["Code"] == "NoSuchBucket":
-            raise HTTPException(status_code=404, detail="Predictions bucket not found")
-        raise HTTPException(status_code=500, detail=f"S3 error: {str(e)}")
-    except Exception as e:
-        raise HTTPException(status_code=500, detail=f"Internal server error: {str(e)}")
+@router.get("/prediction/{scenario_id}/")
+async def get_predictions(scenario_id: UUID, request: Request):
+    try:
+        # Диапазон кадров и фильтры передаются оркестратору как есть
+        resp = await client.get(
+            f"{ORCHESTRATOR_URL}/prediction/{scenario_id}",
+            params=request.query_params,
+        )
+        resp.raise_for_status()
+    except httpx.HTTPStatusError as e:
+        raise parse_httpx_error(e)
+    except httpx.HTTPError as e:
+        raise HTTPException(status_code=500, detail=f"Orchestrator HTTPError: {e}")
+    return resp.json()
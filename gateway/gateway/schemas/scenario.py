@@ -4,3 +4,7 @@ from enum import Enum
 class ScenarioAction(str, Enum):
     START = "start"
     STOP = "stop"
+    PAUSE = "pause"
+    RESUME = "resume"
+    REPROCESS_FAILED = "reprocess_failed"
+    REPLAY = "replay"
@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/api"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/cleanup"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/config"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/gc"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/ingest"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/kafka"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/leader"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/outbox"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/s3"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/watchdog"
 	"github.com/gorilla/mux"
 
@@ -44,10 +50,11 @@ func main() {
 		log.Fatalf("Failed connect to MinIO: %v", err)
 	}
 
-	// Горутина для обработки аутбокса
+	// Конечный автомат статусов сценариев
+	machine := statemachine.New(db)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go outbox.StartOutboxDispatcher(ctx, db, cfg.Kafka.Brokers, cfg.Kafka.ScenarioTopic, 5*time.Second)
 
 	// Горутина для обработки heartbeats раннера
 	consumer, err := kafka.NewConsumer(cfg.Kafka.Brokers, cfg.Kafka.GroupID, cfg.Kafka.HeartbeatTopic)
@@ -55,21 +62,55 @@ func main() {
 		log.Fatalf("Failed to create Kafka consumer: %v", err)
 	}
 	defer consumer.Close()
-	go consumer.StartListening(ctx, db)
+	go consumer.StartListening(ctx, db, machine)
+
+	// Перезапуск упавших раннеров
+	watchDog := watchdog.New(db, machine)
+
+	// Горутины для фонового извлечения кадров из загруженных видео
+	ingester := ingest.New(db, minioClient, machine, cfg.Ingest.Workers)
+	go ingester.Start(ctx)
+
+	// Фоновое удаление данных сценариев
+	cleaner := cleanup.New(db, minioClient)
+
+	// Удаление данных по истечении сроков хранения
+	day := 24 * time.Hour
+	collector := gc.New(db, minioClient, gc.Policy{
+		Frames:      time.Duration(cfg.Retention.FramesDays) * day,
+		Predictions: time.Duration(cfg.Retention.PredictionsDays) * day,
+		Heartbeats:  time.Duration(cfg.Retention.HeartbeatsDays) * day,
+		DryRun:      cfg.Retention.DryRun,
+	})
 
-	// Горутина для перезапуска упавших раннеров
-	watchDog := watchdog.New(db)
-	go watchDog.Start(ctx)
+	// Фоновые задачи запускает только лидер среди экземпляров оркестратора, API обслуживают все.
+	// Аутбокс: команды отправляются по NOTIFY, опрос - страховка
+	go leader.New(db).Run(ctx,
+		func(ctx context.Context) {
+			outbox.StartOutboxDispatcher(ctx, db, machine, cfg.Kafka.Brokers, cfg.Kafka.ScenarioTopic, 30*time.Second, cfg.Outbox.MaxAttempts)
+		},
+		watchDog.Start,
+		cleaner.Start,
+		collector.Start,
+		db.MaintainHeartbeatPartitions,
+	)
 
 	// Настройка роутера
 	r := mux.NewRouter()
-	handlers := api.NewHandlers(db, minioClient)
+	handlers := api.NewHandlers(db, minioClient, ingester, machine)
 
 	// Регистрация обработчиков
 	r.HandleFunc("/scenario", handlers.CreateScenarioHandler).Methods("POST")
+	r.HandleFunc("/scenario", handlers.ListScenariosHandler).Methods("GET")
 	r.HandleFunc("/scenario/{scenario_id}", handlers.GetScenarioStatusHandler).Methods("GET")
 	r.HandleFunc("/scenario/{scenario_id}", handlers.UpdateScenarioStatusHandler).Methods("POST")
+	r.HandleFunc("/scenario/{scenario_id}", handlers.DeleteScenarioHandler).Methods("DELETE")
+	r.HandleFunc("/scenario/{scenario_id}/history", handlers.GetScenarioHistoryHandler).Methods("GET")
 	r.HandleFunc("/prediction/{scenario_id}", handlers.GetPredictionsHandler).Methods("GET")
+	r.HandleFunc("/scenario/{scenario_id}/predictions/stream", handlers.StreamPredictionsHandler).Methods("GET")
+	r.HandleFunc("/admin/outbox/dead", handlers.ListDeadOutboxHandler).Methods("GET")
+	r.HandleFunc("/admin/outbox/{message_id}/requeue", handlers.RequeueOutboxHandler).Methods("POST")
+	r.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 
 	// Запуск сервера
 	log.Println("Starting orchestrator API server on :8002")
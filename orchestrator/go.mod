@@ -3,6 +3,7 @@ module github.com/Capitan-Parrot/distributed-video-system/orhestrator
 go 1.24.0
 
 require (
+	github.com/Capitan-Parrot/distributed-video-system/contract v0.0.0
 	github.com/IBM/sarama v1.43.3
 	github.com/caarlos0/env/v11 v11.2.2
 	github.com/goccy/go-json v0.10.3
@@ -10,6 +11,7 @@ require (
 	github.com/gorilla/mux v1.8.1
 	github.com/lib/pq v1.10.9
 	github.com/minio/minio-go/v7 v7.0.77
+	golang.org/x/sync v0.8.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -43,3 +45,5 @@ require (
 	golang.org/x/sys v0.24.0 // indirect
 	golang.org/x/text v0.17.0 // indirect
 )
+
+replace github.com/Capitan-Parrot/distributed-video-system/contract => ../contract
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
+	"github.com/gorilla/mux"
+)
+
+// ListDeadOutboxHandler возвращает команды, которые outbox не смог отправить раннерам за отведённые попытки
+func (h *Handlers) ListDeadOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	messages, err := h.db.GetDeadOutboxMessages(r.Context())
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages}); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// RequeueOutboxHandler снова ставит мёртвую команду в очередь отправки с обнулённым счётчиком попыток.
+// Сценарий в статусе failed возвращается в статус, в котором он ждёт отправки этой команды
+func (h *Handlers) RequeueOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	messageID := vars["message_id"]
+
+	var msg models.OutboxMessage
+	var status models.ScenarioStatus
+	err := h.db.InTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		msg, err = h.db.RequeueOutboxMessage(ctx, messageID)
+		if err != nil {
+			return err
+		}
+
+		status, err = h.machine.Fire(ctx, msg.ScenarioID, statemachine.Trigger{
+			Event: statemachine.RequeueEvent(msg.Action),
+			Actor: statemachine.ActorAdmin,
+			Cause: fmt.Sprintf("dead command %s requeued", msg.Action),
+		})
+		if errors.Is(err, statemachine.ErrInvalidTransition) {
+			// Например, команда удаления: сценарий остаётся в deleting
+			log.Printf("Scenario %s status is not changed by requeued command: %v", msg.ScenarioID, err)
+			status, err = "", nil
+		}
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Dead outbox message not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := map[string]string{"id": msg.ID, "scenario_id": msg.ScenarioID, "action": string(msg.Action)}
+	if status != "" {
+		response["status"] = string(status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
@@ -1,23 +1,31 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"time"
 
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/ingest"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
 	"github.com/google/uuid"
 )
 
 func (h *Handlers) CreateScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	// JSON тело регистрирует сценарий по ссылке на уже существующее видео или поток
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		h.createScenarioFromSource(w, r)
+		return
+	}
+
 	if err := r.ParseMultipartForm(50 << 20); err != nil {
 		http.Error(w, "Could not parse multipart form", http.StatusBadRequest)
 		return
@@ -36,137 +44,138 @@ func (h *Handlers) CreateScenarioHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	opts, err := extractionFromForm(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid extraction options: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	id := uuid.New().String()
-	tempDir := os.TempDir()
 
-	// Сохраняем видео во временный файл
-	videoPath := filepath.Join(tempDir, fmt.Sprintf("%s.mp4", id))
+	// Сохраняем видео во временный файл, кадры из него извлекаются в фоне
+	videoPath := filepath.Join(os.TempDir(), fmt.Sprintf("%s.mp4", id))
 	tempFile, err := os.Create(videoPath)
 	if err != nil {
 		http.Error(w, "Failed to create temp file", http.StatusInternalServerError)
 		return
 	}
-	defer os.Remove(videoPath)
 	defer tempFile.Close()
 	if _, err := io.Copy(tempFile, file); err != nil {
+		os.Remove(videoPath)
 		http.Error(w, "Failed to save video file", http.StatusInternalServerError)
 		return
 	}
 	tempFile.Close()
 
-	// Извлекаем кадры из видео
-	framesPath := filepath.Join(tempDir, fmt.Sprintf("frames_%s", id))
-	if err := os.MkdirAll(framesPath, 0755); err != nil {
-		http.Error(w, fmt.Sprintf("failed to create frames directory: %v", err), http.StatusInternalServerError)
-	}
-	defer os.RemoveAll(framesPath)
-	frames, err := extractFrames(framesPath, videoPath)
+	defer os.Remove(videoPath)
+
+	ctx := context.Background()
+	meta, err := h.probeVideo(ctx, videoPath, opts)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to extract frames: %v", err), http.StatusInternalServerError)
+		writeProbeError(w, err)
 		return
 	}
 
-	ctx := context.Background()
-	// Сохраняем в S3
-	err = h.saveFrames(ctx, id, frames)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to save frames: %v", err), http.StatusInternalServerError)
+	// Видео сохраняется в S3 до ответа клиенту: извлечение кадров может продолжить другой экземпляр
+	if err := h.ingester.SaveUpload(ctx, id, videoPath); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save video file: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	now := time.Now()
-	initialStatus := models.StatusInitStartup
+	h.startIngest(ctx, w, id, ingest.UploadSource(id), opts, meta)
+}
 
+// startIngest сохраняет сценарий в статусе ingesting и ставит извлечение кадров в очередь.
+// Клиент получает 202 сразу, команда start уйдёт в outbox после извлечения
+func (h *Handlers) startIngest(ctx context.Context, w http.ResponseWriter, id, source string, opts models.ExtractionOptions, meta models.VideoMetadata) {
+	now := time.Now()
 	scenario := models.Scenario{
-		ID:          id,
-		Status:      initialStatus,
-		VideoSource: fmt.Sprintf("frames/%s", id),
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		ID:           id,
+		Status:       models.StatusIngesting,
+		VideoSource:  fmt.Sprintf("frames/%s", id),
+		IngestSource: source,
+		Extraction:   &opts,
+		Video:        &meta,
+		CreatedAt:    now,
+		UpdatedAt:    now,
 	}
 
-	if err := h.db.InTx(ctx, func(ctx context.Context) error {
-		if err := h.db.CreateScenario(ctx, &scenario); err != nil {
-			return fmt.Errorf("failed to insert scenario: %w", err)
-		}
+	if err := h.machine.Create(ctx, &scenario, statemachine.ActorAPI, "video submitted for frame extraction"); err != nil {
+		h.ingester.RemoveUpload(ctx, id)
+		http.Error(w, fmt.Sprintf("Failed to create scenario: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-		if err := h.db.AddToOutbox(ctx, scenario.ID, models.CommandStart); err != nil {
-			return fmt.Errorf("failed to add to outbox: %w", err)
+	if err := h.ingester.Submit(ingest.Job{ScenarioID: id, Source: source, Options: opts}); err != nil {
+		h.ingester.RemoveUpload(ctx, id)
+		if err := h.ingester.Fail(ctx, id, err); err != nil {
+			log.Printf("Failed to mark scenario %s as failed: %v", id, err)
 		}
-
-		return nil
-	}); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create scenario: %v", err), http.StatusInternalServerError)
+		http.Error(w, "Ingest queue is full, try again later", http.StatusServiceUnavailable)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"id":     id,
-		"status": initialStatus,
+		"status": scenario.Status,
 	})
 }
 
-// extractFrames извлекает кадры из видео и загружает их в S3
-func extractFrames(framesPath, videoPath string) ([]string, error) {
-	t := time.Now()
-	fmt.Println("extractFrames started")
-	// Извлекаем кадры с помощью ffmpeg
-	framePattern := filepath.Join(framesPath, "frame_%04d.jpg")
-	cmd := exec.Command("ffmpeg",
-		"-i", videoPath,
-		"-vf", "fps=3",
-		"-q:v", "2", // Качество JPEG
-		framePattern,
-	)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// registerScenario сохраняет новый сценарий вместе с командой запуска в outbox и отвечает клиенту.
+// Кадры уже доступны раннеру, поэтому сценарий сразу создаётся в init_startup
+func (h *Handlers) registerScenario(ctx context.Context, w http.ResponseWriter, id, videoSource string) {
+	now := time.Now()
+	initialStatus := models.StatusInitStartup
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("ffmpeg failed: %w, stderr: %s", err, stderr.String())
+	scenario := models.Scenario{
+		ID:          id,
+		Status:      initialStatus,
+		VideoSource: videoSource,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
-	log.Println(time.Now().Sub(t))
 
-	files, err := filepath.Glob(filepath.Join(framesPath, "frame_*.jpg"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to list frame files: %w", err)
+	if err := h.machine.Create(ctx, &scenario, statemachine.ActorAPI, "scenario registered from "+videoSource); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create scenario: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	return files, nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     id,
+		"status": initialStatus,
+	})
 }
 
-func (h *Handlers) saveFrames(ctx context.Context, scenarioID string, files []string) error {
-	frameCount := len(files)
-	if frameCount == 0 {
-		return fmt.Errorf("no frames extracted from video")
-	}
-
-	// Загружаем каждый кадр в S3
-	for _, framePath := range files {
-		frameFile, err := os.Open(framePath)
-		if err != nil {
-			return fmt.Errorf("failed to open frame file %s: %w", framePath, err)
-		}
-
-		frameInfo, err := frameFile.Stat()
-		if err != nil {
-			frameFile.Close()
-			return fmt.Errorf("failed to get frame file info: %w", err)
+// extractionFromForm читает настройки извлечения кадров из полей multipart формы.
+// Незаполненные поля получают значения по умолчанию
+func extractionFromForm(r *http.Request) (models.ExtractionOptions, error) {
+	opts := models.DefaultExtractionOptions()
+
+	floats := map[string]*float64{"fps": &opts.FPS, "start": &opts.Start, "end": &opts.End}
+	for name, dst := range floats {
+		if v := r.FormValue(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be a number", name)
+			}
+			*dst = f
 		}
+	}
 
-		// Имя файла в S3: frames/{scenarioID}/frame_0001.jpg
-		fileName := filepath.Base(framePath)
-		objectName := fmt.Sprintf("%s/%s", scenarioID, fileName)
-
-		_, err = h.s3.UploadFileStream(ctx, "frames", objectName, frameFile, frameInfo.Size())
-		frameFile.Close()
-
-		if err != nil {
-			return fmt.Errorf("failed to upload frame %s to S3: %w", fileName, err)
+	ints := map[string]*int{"quality": &opts.Quality, "max_width": &opts.MaxWidth, "max_height": &opts.MaxHeight}
+	for name, dst := range ints {
+		if v := r.FormValue(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be an integer", name)
+			}
+			*dst = n
 		}
 	}
 
-	return nil
+	return opts, opts.Validate()
 }
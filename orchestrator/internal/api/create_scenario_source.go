@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/google/uuid"
+)
+
+// Типы источников видео в ScenarioCreate.SourceType
+const (
+	sourceTypeFile   = "file"
+	sourceTypeStream = "stream"
+)
+
+// createScenarioFromSource создаёт сценарий по ссылке на видео вместо загрузки файла:
+//   - s3://bucket/key.mp4 - видео, уже лежащее в S3, кадры извлекаются фоновым ingest
+//   - s3://bucket/prefix/ - папка с уже извлечёнными кадрами, используется раннером как есть
+//   - http(s)://... - видеофайл, который ingest скачивает и нарезает на кадры
+//   - rtsp://... или http(s)://... с source_type=stream - живой поток, читаемый раннером напрямую
+func (h *Handlers) createScenarioFromSource(w http.ResponseWriter, r *http.Request) {
+	var req models.ScenarioCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(req.VideoSource)
+	if err != nil || req.VideoSource == "" {
+		http.Error(w, "video_source must be a valid URL", http.StatusBadRequest)
+		return
+	}
+	if req.SourceType != "" && req.SourceType != sourceTypeFile && req.SourceType != sourceTypeStream {
+		http.Error(w, "source_type must be file or stream", http.StatusBadRequest)
+		return
+	}
+
+	// config задаёт настройки извлечения кадров и учитывается только для видеофайлов
+	opts := models.DefaultExtractionOptions()
+	if len(req.Config) > 0 && string(req.Config) != "null" {
+		if err := json.Unmarshal(req.Config, &opts); err != nil {
+			http.Error(w, "Invalid config", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid extraction options: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	id := uuid.New().String()
+	ctx := context.Background()
+
+	switch {
+	case u.Scheme == "rtsp", u.Scheme == "rtsps",
+		req.SourceType == sourceTypeStream && (u.Scheme == "http" || u.Scheme == "https"):
+		h.registerScenario(ctx, w, id, req.VideoSource)
+
+	case u.Scheme == "s3" && strings.HasSuffix(u.Path, "/"):
+		prefix := strings.TrimPrefix(u.Path, "/")
+		exists, err := h.s3.HasObjects(ctx, u.Host, prefix)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check frames: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "No frames found under video_source", http.StatusBadRequest)
+			return
+		}
+		h.registerScenario(ctx, w, id, u.Host+"/"+prefix)
+
+	case u.Scheme == "s3", u.Scheme == "http", u.Scheme == "https":
+		input := u.String()
+		if u.Scheme == "s3" {
+			// ffprobe не умеет s3://, читает объект по временной ссылке
+			input, err = h.s3.PresignedGetURL(ctx, u.Host, strings.TrimPrefix(u.Path, "/"), time.Hour)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to access video: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		meta, err := h.probeVideo(ctx, input, opts)
+		if err != nil {
+			writeProbeError(w, err)
+			return
+		}
+		h.startIngest(ctx, w, id, u.String(), opts, meta)
+
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported video_source scheme %q", u.Scheme), http.StatusBadRequest)
+	}
+}
+
+// isStreamSource сообщает, читает ли раннер сохранённый video_source как живой поток.
+// HTTP видеофайлы к этому моменту уже нарезаны на кадры в frames/{id}
+func isStreamSource(videoSource string) bool {
+	u, err := url.Parse(videoSource)
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "rtsp", "rtsps", "http", "https":
+		return true
+	default:
+		return false
+	}
+}
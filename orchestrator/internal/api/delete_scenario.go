@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
+	"github.com/gorilla/mux"
+)
+
+// DeleteScenarioHandler останавливает сценарий и переводит его в deleting.
+// Кадры, результаты и записи сценария удаляются в фоне, ход удаления виден в статусе сценария,
+// пока он не начнёт возвращать 404
+func (h *Handlers) DeleteScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scenarioID := vars["scenario_id"]
+
+	var status models.ScenarioStatus
+	err := h.db.InTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		status, err = h.machine.Fire(ctx, scenarioID, statemachine.Trigger{
+			Event: statemachine.EventDelete,
+			Actor: statemachine.ActorAPI,
+			Cause: "delete requested",
+		})
+		if err != nil {
+			return err
+		}
+		return h.db.StartDeletion(ctx, scenarioID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Scenario not found", http.StatusNotFound)
+		case errors.Is(err, statemachine.ErrInvalidTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"id": scenarioID, "status": string(status)}); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetScenarioHistoryHandler возвращает историю переходов сценария между статусами
+func (h *Handlers) GetScenarioHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scenarioID := vars["scenario_id"]
+
+	if _, err := h.db.GetScenarioByID(scenarioID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Scenario not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	transitions, err := h.db.GetTransitions(r.Context(), scenarioID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scenario_id": scenarioID,
+		"transitions": transitions,
+	})
+}
@@ -1,24 +1,50 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
 	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
 )
 
-// GetPredictionsHandler обработчик для получения предсказаний по ID сценария
+const (
+	defaultPredictionsLimit = 100
+	maxPredictionsLimit     = 1000
+	// predictionFetchers сколько файлов результатов читается из S3 параллельно
+	predictionFetchers = 8
+)
+
+// GetPredictionsHandler обработчик для получения предсказаний по ID сценария.
+// Результаты читаются из бакета predictions, куда их пишет раннер. Параметры запроса:
+//   - from_frame, to_frame - диапазон кадров, to_frame включительно
+//   - limit - сколько кадров просмотреть за страницу, продолжение - с next_frame
+//   - class - классы объектов через запятую, min_score - минимальная уверенность
+//   - version - версия результатов, 0 - исходная обработка, далее - повторные прогоны
+//
+// Если задан class или min_score, кадры без подходящих объектов не попадают в ответ
 func (h *Handlers) GetPredictionsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	scenarioID := vars["scenario_id"]
 
-	// Проверка существования сценария
-	var exists bool
-	err := h.db.DB.QueryRow("SELECT 1 FROM scenarios WHERE id = $1", scenarioID).Scan(&exists)
+	filter, err := parsePredictionFilter(r.URL.Query())
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Проверка существования сценария
+	if _, err := h.db.GetScenarioByID(scenarioID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			http.Error(w, "Scenario not found", http.StatusNotFound)
 		} else {
@@ -27,27 +53,117 @@ func (h *Handlers) GetPredictionsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Получение всех предсказаний для сценария
-	rows, err := h.db.DB.Query(
-		"SELECT id, scenario_id, timestamp, data FROM predictions WHERE scenario_id = ? ORDER BY timestamp DESC LIMIT 100",
-		scenarioID,
-	)
+	frames, err := h.s3.ListPredictionFrames(r.Context(), scenarioID, filter.Version)
 	if err != nil {
-		http.Error(w, "Failed to fetch predictions", http.StatusInternalServerError)
+		http.Error(w, "Failed to list predictions", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var predictions []models.Prediction
-	for rows.Next() {
-		var prediction models.Prediction
-		if err := rows.Scan(&prediction.ID, &prediction.ScenarioID, &prediction.Timestamp, &prediction.Data); err != nil {
-			http.Error(w, "Failed to parse predictions", http.StatusInternalServerError)
-			return
+	// Кадры страницы: начиная с from_frame и не дальше to_frame
+	start := sort.SearchInts(frames, filter.FromFrame)
+	end := len(frames)
+	if filter.ToFrame >= 0 {
+		end = sort.SearchInts(frames, filter.ToFrame+1)
+	}
+	page := frames[start:max(start, end)]
+
+	var nextFrame *int
+	if len(page) > filter.Limit {
+		next := page[filter.Limit]
+		nextFrame = &next
+		page = page[:filter.Limit]
+	}
+
+	predictions, err := h.fetchPredictions(r.Context(), scenarioID, filter.Version, page)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read predictions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	filtered := len(filter.Classes) > 0 || filter.MinScore > 0
+	result := make([]models.FramePrediction, 0, len(predictions))
+	for _, prediction := range predictions {
+		prediction.Detections = filterDetections(prediction.Detections, filter)
+		if filtered && len(prediction.Detections) == 0 {
+			continue
 		}
-		predictions = append(predictions, prediction)
+		result = append(result, prediction)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(predictions)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scenario_id": scenarioID,
+		"predictions": result,
+		"next_frame":  nextFrame,
+	})
+}
+
+// fetchPredictions параллельно читает результаты кадров, сохраняя их порядок
+func (h *Handlers) fetchPredictions(ctx context.Context, scenarioID string, version int, frames []int) ([]models.FramePrediction, error) {
+	predictions := make([]models.FramePrediction, len(frames))
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(predictionFetchers)
+	for i, frame := range frames {
+		g.Go(func() error {
+			detections, err := h.s3.GetPrediction(ctx, scenarioID, version, frame)
+			if err != nil {
+				return err
+			}
+			predictions[i] = models.FramePrediction{Frame: frame, Detections: detections}
+			return nil
+		})
+	}
+
+	return predictions, g.Wait()
+}
+
+func filterDetections(detections []models.Detection, filter models.PredictionFilter) []models.Detection {
+	result := make([]models.Detection, 0, len(detections))
+	for _, detection := range detections {
+		if detection.Score < filter.MinScore {
+			continue
+		}
+		if len(filter.Classes) > 0 && !slices.Contains(filter.Classes, detection.Class) {
+			continue
+		}
+		result = append(result, detection)
+	}
+	return result
+}
+
+func parsePredictionFilter(q url.Values) (models.PredictionFilter, error) {
+	filter := models.PredictionFilter{ToFrame: -1, Limit: defaultPredictionsLimit}
+
+	ints := map[string]*int{"from_frame": &filter.FromFrame, "to_frame": &filter.ToFrame, "limit": &filter.Limit, "version": &filter.Version}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+	if filter.Limit < 1 || filter.Limit > maxPredictionsLimit {
+		return filter, fmt.Errorf("limit must be in range [1, %d]", maxPredictionsLimit)
+	}
+
+	for _, value := range q["class"] {
+		for _, class := range strings.Split(value, ",") {
+			if class = strings.TrimSpace(class); class != "" {
+				filter.Classes = append(filter.Classes, class)
+			}
+		}
+	}
+
+	if v := q.Get("min_score"); v != "" {
+		score, err := strconv.ParseFloat(v, 64)
+		if err != nil || score < 0 || score > 1 {
+			return filter, fmt.Errorf("min_score must be a number in range [0, 1]")
+		}
+		filter.MinScore = score
+	}
+
+	return filter, nil
 }
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+func TestParsePredictionFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    models.PredictionFilter
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  models.PredictionFilter{ToFrame: -1, Limit: defaultPredictionsLimit},
+		},
+		{
+			name:  "range and filters",
+			query: "from_frame=10&to_frame=20&limit=5&class=person,+car&class=dog&min_score=0.5",
+			want: models.PredictionFilter{
+				FromFrame: 10,
+				ToFrame:   20,
+				Limit:     5,
+				Classes:   []string{"person", "car", "dog"},
+				MinScore:  0.5,
+			},
+		},
+		{name: "negative frame", query: "from_frame=-1", wantErr: true},
+		{name: "not a number", query: "to_frame=last", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit too large", query: "limit=1001", wantErr: true},
+		{name: "score too large", query: "min_score=1.5", wantErr: true},
+		{name: "bad score", query: "min_score=high", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parsePredictionFilter(q)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got filter %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterDetections(t *testing.T) {
+	detections := []models.Detection{
+		{Class: "person", Score: 0.9},
+		{Class: "car", Score: 0.4},
+		{Class: "person", Score: 0.3},
+		{Class: "dog", Score: 0.8},
+	}
+
+	tests := []struct {
+		name   string
+		filter models.PredictionFilter
+		want   []models.Detection
+	}{
+		{name: "no filter", want: detections},
+		{name: "min score", filter: models.PredictionFilter{MinScore: 0.4}, want: []models.Detection{detections[0], detections[1], detections[3]}},
+		{name: "classes", filter: models.PredictionFilter{Classes: []string{"person"}}, want: []models.Detection{detections[0], detections[2]}},
+		{name: "both", filter: models.PredictionFilter{Classes: []string{"person", "car"}, MinScore: 0.5}, want: []models.Detection{detections[0]}},
+		{name: "nothing matches", filter: models.PredictionFilter{MinScore: 0.95}, want: []models.Detection{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterDetections(detections, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
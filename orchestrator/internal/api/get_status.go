@@ -24,6 +24,12 @@ func (h *Handlers) GetScenarioStatusHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	row.FailedFrames, err = h.db.GetFrameFailures(r.Context(), scenarioID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(row)
 }
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// listCursor непрозрачный для клиента курсор страницы. Сортировка хранится вместе с позицией,
+// чтобы курсор нельзя было применить к списку с другим порядком
+type listCursor struct {
+	models.ScenarioCursor
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d"`
+}
+
+// ListScenariosHandler возвращает сценарии с фильтрами по статусу, времени создания и источнику видео.
+// Параметры запроса:
+//   - status - один или несколько статусов через запятую
+//   - created_from, created_to - границы времени создания в RFC 3339, created_to не включается
+//   - video_source - префикс video_source
+//   - sort - created_at (по умолчанию) или updated_at, order - desc (по умолчанию) или asc
+//   - limit - размер страницы, cursor - next_cursor из предыдущего ответа
+func (h *Handlers) ListScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseScenarioFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Запрашиваем на один сценарий больше, чтобы понять, есть ли следующая страница
+	pageSize := filter.Limit
+	filter.Limit++
+	scenarios, err := h.db.ListScenarios(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(scenarios) > pageSize {
+		scenarios = scenarios[:pageSize]
+		last := scenarios[pageSize-1]
+		cursor := listCursor{
+			ScenarioCursor: models.ScenarioCursor{Time: last.CreatedAt, ID: last.ID},
+			SortBy:         filter.SortBy,
+			Desc:           filter.Desc,
+		}
+		if filter.SortBy == models.SortByUpdatedAt {
+			cursor.Time = last.UpdatedAt
+		}
+		nextCursor = encodeCursor(cursor)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scenarios":   scenarios,
+		"next_cursor": nextCursor,
+	})
+}
+
+func parseScenarioFilter(q url.Values) (models.ScenarioFilter, error) {
+	filter := models.ScenarioFilter{
+		SortBy:      models.SortByCreatedAt,
+		Desc:        true,
+		Limit:       defaultListLimit,
+		VideoSource: q.Get("video_source"),
+	}
+
+	for _, value := range q["status"] {
+		for _, status := range strings.Split(value, ",") {
+			status := models.ScenarioStatus(strings.TrimSpace(status))
+			if !slices.Contains(models.Statuses, status) {
+				return filter, fmt.Errorf("unknown status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	for name, dst := range map[string]**time.Time{"created_from": &filter.CreatedFrom, "created_to": &filter.CreatedTo} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			// Колонки без часового пояса хранят время в UTC
+			t = t.UTC()
+			*dst = &t
+		}
+	}
+
+	switch sort := q.Get("sort"); sort {
+	case "", models.SortByCreatedAt:
+	case models.SortByUpdatedAt:
+		filter.SortBy = sort
+	default:
+		return filter, fmt.Errorf("sort must be %s or %s", models.SortByCreatedAt, models.SortByUpdatedAt)
+	}
+
+	switch order := q.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Desc = false
+	default:
+		return filter, fmt.Errorf("order must be asc or desc")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return filter, fmt.Errorf("limit must be in range [1, %d]", maxListLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid cursor")
+		}
+		if cursor.SortBy != filter.SortBy || cursor.Desc != filter.Desc {
+			return filter, fmt.Errorf("cursor was issued for a different sort order")
+		}
+		filter.After = &cursor.ScenarioCursor
+	}
+
+	return filter, nil
+}
+
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
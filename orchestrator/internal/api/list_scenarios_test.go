@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+func TestParseScenarioFilter(t *testing.T) {
+	createdFrom := time.Date(2025, 3, 14, 6, 0, 0, 0, time.UTC)
+	cursor := listCursor{
+		ScenarioCursor: models.ScenarioCursor{Time: createdFrom, ID: "b3a9d2f0"},
+		SortBy:         models.SortByUpdatedAt,
+		Desc:           false,
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    models.ScenarioFilter
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  models.ScenarioFilter{SortBy: models.SortByCreatedAt, Desc: true, Limit: defaultListLimit},
+		},
+		{
+			name:  "statuses",
+			query: "status=active,+paused&status=inactive&video_source=s3://videos/",
+			want: models.ScenarioFilter{
+				Statuses:    []models.ScenarioStatus{models.StatusActive, models.StatusPaused, models.StatusInactive},
+				VideoSource: "s3://videos/",
+				SortBy:      models.SortByCreatedAt,
+				Desc:        true,
+				Limit:       defaultListLimit,
+			},
+		},
+		{
+			// Время с часовым поясом приводится к UTC, в котором хранятся колонки
+			name:  "created from",
+			query: "created_from=" + url.QueryEscape("2025-03-14T09:00:00+03:00"),
+			want:  models.ScenarioFilter{CreatedFrom: &createdFrom, SortBy: models.SortByCreatedAt, Desc: true, Limit: defaultListLimit},
+		},
+		{
+			name:  "cursor",
+			query: "sort=updated_at&order=asc&limit=10&cursor=" + encodeCursor(cursor),
+			want: models.ScenarioFilter{
+				SortBy: models.SortByUpdatedAt,
+				Limit:  10,
+				After:  &cursor.ScenarioCursor,
+			},
+		},
+		{name: "unknown status", query: "status=running", wantErr: true},
+		{name: "bad time", query: "created_to=yesterday", wantErr: true},
+		{name: "bad sort", query: "sort=id", wantErr: true},
+		{name: "bad order", query: "order=up", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit too large", query: "limit=501", wantErr: true},
+		{name: "bad cursor", query: "cursor=not-a-cursor", wantErr: true},
+		// Курсор выдан для другого порядка сортировки
+		{name: "cursor of other order", query: "sort=updated_at&cursor=" + encodeCursor(cursor), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parseScenarioFilter(q)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got filter %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := listCursor{
+		ScenarioCursor: models.ScenarioCursor{Time: time.Date(2025, 3, 14, 9, 26, 53, 589793000, time.UTC), ID: "b3a9d2f0"},
+		SortBy:         models.SortByCreatedAt,
+		Desc:           true,
+	}
+
+	got, err := decodeCursor(encodeCursor(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(cursor.Time) || got.ID != cursor.ID || got.SortBy != cursor.SortBy || got.Desc != cursor.Desc {
+		t.Errorf("got %+v, want %+v", got, cursor)
+	}
+}
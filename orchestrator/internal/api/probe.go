@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/ingest"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+// probeVideo проверяет видео до создания сценария, чтобы битые и неподдерживаемые
+// файлы отклонялись сразу, а не падали при извлечении кадров
+func (h *Handlers) probeVideo(ctx context.Context, input string, opts models.ExtractionOptions) (models.VideoMetadata, error) {
+	meta, err := ingest.Probe(ctx, input)
+	if err != nil {
+		return meta, err
+	}
+	return meta, ingest.CheckTimeRange(meta, opts)
+}
+
+// writeProbeError отвечает клиенту кодом ошибки проверки видео и её описанием
+func writeProbeError(w http.ResponseWriter, err error) {
+	status := http.StatusUnprocessableEntity
+	var probeErr *ingest.ProbeError
+	if !errors.As(err, &probeErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case probeErr.Temporary():
+		status = http.StatusServiceUnavailable
+	case probeErr.Code == ingest.ProbeUnsupportedFormat, probeErr.Code == ingest.ProbeUnsupportedCodec:
+		status = http.StatusUnsupportedMediaType
+	case probeErr.Code == ingest.ProbeInvalidTimeRange:
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   probeErr.Code,
+		"message": probeErr.Message,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+// parseReplayRange читает диапазон повторного прогона из параметров запроса.
+// Диапазон задаётся кадрами from_frame и to_frame или временем from_time и to_time
+// в секундах от начала видео. Время переводится в кадры по настройкам извлечения сценария
+func parseReplayRange(q url.Values, scenario models.Scenario) (models.ReplayRange, error) {
+	replay := models.ReplayRange{ToFrame: -1}
+
+	byFrame := q.Get("from_frame") != "" || q.Get("to_frame") != ""
+	byTime := q.Get("from_time") != "" || q.Get("to_time") != ""
+	switch {
+	case byFrame && byTime:
+		return replay, errors.New("use either from_frame/to_frame or from_time/to_time")
+	case byTime:
+		return replayRangeByTime(q, scenario.Extraction)
+	}
+
+	ints := map[string]*int64{"from_frame": &replay.FromFrame, "to_frame": &replay.ToFrame}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return replay, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+	if replay.ToFrame >= 0 && replay.ToFrame < replay.FromFrame {
+		return replay, errors.New("to_frame must not be less than from_frame")
+	}
+
+	return replay, nil
+}
+
+// replayRangeByTime переводит отрезок времени в кадры: кадр i извлечён
+// в момент start + i/fps, поэтому в диапазон попадают кадры внутри отрезка
+func replayRangeByTime(q url.Values, extraction *models.ExtractionOptions) (models.ReplayRange, error) {
+	replay := models.ReplayRange{ToFrame: -1}
+	if extraction == nil {
+		return replay, errors.New("scenario frames have no timestamps, use from_frame/to_frame")
+	}
+
+	fromTime, toTime := extraction.Start, -1.0
+	floats := map[string]*float64{"from_time": &fromTime, "to_time": &toTime}
+	for name, dst := range floats {
+		if v := q.Get(name); v != "" {
+			t, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(t) || math.IsInf(t, 0) || t < 0 {
+				return replay, fmt.Errorf("%s must be a non-negative number of seconds", name)
+			}
+			*dst = t
+		}
+	}
+	if toTime >= 0 && toTime < fromTime {
+		return replay, errors.New("to_time must not be less than from_time")
+	}
+
+	replay.FromFrame = int64(math.Ceil(max(fromTime-extraction.Start, 0) * extraction.FPS))
+	if toTime >= 0 {
+		if toTime < extraction.Start {
+			return replay, fmt.Errorf("frames were extracted starting from %g seconds", extraction.Start)
+		}
+		replay.ToFrame = int64(math.Floor((toTime - extraction.Start) * extraction.FPS))
+		if replay.ToFrame < replay.FromFrame {
+			return replay, errors.New("time range contains no extracted frames")
+		}
+	}
+
+	return replay, nil
+}
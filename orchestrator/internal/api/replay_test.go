@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+func TestParseReplayRange(t *testing.T) {
+	// Кадры извлечены с 10-й секунды по 2 кадра в секунду: кадр i снят в момент 10 + i/2
+	extracted := models.Scenario{Extraction: &models.ExtractionOptions{FPS: 2, Quality: 2, Start: 10}}
+
+	tests := []struct {
+		name     string
+		query    string
+		scenario models.Scenario
+		want     models.ReplayRange
+		wantErr  bool
+	}{
+		{name: "all frames", query: "", want: models.ReplayRange{ToFrame: -1}},
+		{name: "frames", query: "from_frame=5&to_frame=9", want: models.ReplayRange{FromFrame: 5, ToFrame: 9}},
+		{name: "open end", query: "from_frame=5", want: models.ReplayRange{FromFrame: 5, ToFrame: -1}},
+		{name: "single frame", query: "from_frame=5&to_frame=5", want: models.ReplayRange{FromFrame: 5, ToFrame: 5}},
+		{name: "to before from", query: "from_frame=5&to_frame=4", wantErr: true},
+		{name: "negative frame", query: "from_frame=-1", wantErr: true},
+		{name: "frames and time", query: "from_frame=1&to_time=3", scenario: extracted, wantErr: true},
+		{name: "time", query: "from_time=11&to_time=12.4", scenario: extracted, want: models.ReplayRange{FromFrame: 2, ToFrame: 4}},
+		// Начало отрезка между кадрами: берётся следующий кадр
+		{name: "time between frames", query: "from_time=11.2", scenario: extracted, want: models.ReplayRange{FromFrame: 3, ToFrame: -1}},
+		{name: "time before extraction start", query: "from_time=0&to_time=10", scenario: extracted, want: models.ReplayRange{FromFrame: 0, ToFrame: 0}},
+		{name: "to time before extraction start", query: "to_time=5", scenario: extracted, wantErr: true},
+		{name: "no frames in time range", query: "from_time=11.1&to_time=11.4", scenario: extracted, wantErr: true},
+		{name: "to time before from time", query: "from_time=12&to_time=11", scenario: extracted, wantErr: true},
+		{name: "NaN time", query: "from_time=NaN", scenario: extracted, wantErr: true},
+		{name: "time without extraction settings", query: "from_time=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parseReplayRange(q, tt.scenario)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got range %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,14 +2,18 @@ package api
 
 import (
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/ingest"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/s3"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
 )
 
 type Handlers struct {
-	db *database.Database
-	s3 *s3.Client
+	db       *database.Database
+	s3       *s3.Client
+	ingester *ingest.Ingester
+	machine  *statemachine.Machine
 }
 
-func NewHandlers(db *database.Database, s3 *s3.Client) *Handlers {
-	return &Handlers{db: db, s3: s3}
+func NewHandlers(db *database.Database, s3 *s3.Client, ingester *ingest.Ingester, machine *statemachine.Machine) *Handlers {
+	return &Handlers{db: db, s3: s3, ingester: ingester, machine: machine}
 }
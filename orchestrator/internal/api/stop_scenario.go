@@ -8,18 +8,35 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
 	"github.com/gorilla/mux"
 )
 
+// actionEvents события конечного автомата, соответствующие action запроса
+var actionEvents = map[models.CommandAction]statemachine.Event{
+	models.CommandStart:           statemachine.EventStart,
+	models.CommandStop:            statemachine.EventStop,
+	models.CommandReprocessFailed: statemachine.EventReprocessFailed,
+	models.CommandPause:           statemachine.EventPause,
+	models.CommandResume:          statemachine.EventResume,
+	models.CommandReplay:          statemachine.EventReplay,
+}
+
 // UpdateScenarioStatusHandler обработчик для обновления статуса сценария
 func (h *Handlers) UpdateScenarioStatusHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	scenarioID := vars["scenario_id"]
 	action := models.CommandAction(r.URL.Query().Get("action"))
 	if action == "" {
-		http.Error(w, "action parameter is required (start/stop)", http.StatusBadRequest)
+		http.Error(w, "action parameter is required (start/stop/pause/resume/reprocess_failed/replay)", http.StatusBadRequest)
+		return
+	}
+	event, ok := actionEvents[action]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown action %s", action), http.StatusBadRequest)
 		return
 	}
 
@@ -33,101 +50,86 @@ func (h *Handlers) UpdateScenarioStatusHandler(w http.ResponseWriter, r *http.Re
 		}
 		return
 	}
-	currentStatus := scenario.Status
-
-	var newStatus models.ScenarioStatus
-	ctx := context.Background()
-	if action == models.CommandStart {
-		switch currentStatus {
-		case models.StatusInitStartup, models.StatusInStartupProcessing, models.StatusActive:
-			http.Error(w, fmt.Sprintf("Invalid transaction from status %s", currentStatus), http.StatusBadRequest)
-			return
-		case models.StatusInitShutdown:
-			if err := h.db.InTx(ctx, func(ctx context.Context) error {
-				_, err := h.db.MarkOutboxMessageProcessedByScenarioID(ctx, scenarioID)
-				if err != nil {
-					return err
-				}
-
-				err = h.db.UpdateScenarioStatus(ctx, scenarioID, models.StatusInitStartup)
-				if err != nil {
-					return err
-				}
 
-				err = h.db.AddToOutbox(ctx, scenarioID, models.CommandStart)
-				if err != nil {
-					return err
-				}
+	ctx := r.Context()
+	trigger := statemachine.Trigger{
+		Event: event,
+		Actor: statemachine.ActorAPI,
+		Cause: fmt.Sprintf("action %s requested", action),
+	}
 
-				return nil
-			}); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
+	if (action == models.CommandReprocessFailed || action == models.CommandReplay) && scenario.FramesPurgedAt != nil {
+		http.Error(w, "Frames of the scenario were removed by the retention policy", http.StatusConflict)
+		return
+	}
 
-			newStatus = models.StatusInitShutdown
-		case models.StatusInShutdownProcessing, models.StatusInactive:
-			if err := h.db.InTx(ctx, func(ctx context.Context) error {
-				err = h.db.UpdateScenarioStatus(ctx, scenarioID, models.StatusInitStartup)
-				if err != nil {
-					return err
-				}
-				err = h.db.AddToOutbox(ctx, scenarioID, models.CommandStart)
-				if err != nil {
-					return err
-				}
+	if action == models.CommandReprocessFailed && statemachine.Can(scenario.Status, event) {
+		// Повторно обрабатываем только упавшие кадры уже завершённого сценария
+		if isStreamSource(scenario.VideoSource) {
+			http.Error(w, "Frames of a live stream can not be reprocessed", http.StatusBadRequest)
+			return
+		}
 
-				return nil
-			}); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
-			newStatus = models.StatusInitStartup
+		failures, err := h.db.GetFrameFailures(ctx, scenarioID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
 		}
-	} else if action == models.CommandStop {
-		switch currentStatus {
-		case models.StatusInitShutdown, models.StatusInShutdownProcessing, models.StatusInactive:
-			http.Error(w, fmt.Sprintf("Invalid transaction from status %s", currentStatus), http.StatusBadRequest)
+		if len(failures) == 0 {
+			http.Error(w, "Scenario has no failed frames", http.StatusBadRequest)
 			return
-		case models.StatusInitStartup:
-			if err := h.db.InTx(ctx, func(ctx context.Context) error {
-				_, err := h.db.MarkOutboxMessageProcessedByScenarioID(ctx, scenarioID)
-				if err != nil {
-					return err
-				}
+		}
 
-				err = h.db.UpdateScenarioStatus(ctx, scenarioID, models.StatusInitShutdown)
-				if err != nil {
-					return err
-				}
+		for _, f := range failures {
+			trigger.Payload.Frames = append(trigger.Payload.Frames, f.Frame)
+		}
+	}
 
-				err = h.db.AddToOutbox(ctx, scenarioID, models.CommandStop)
-				if err != nil {
-					return err
-				}
+	if action == models.CommandReplay && statemachine.Can(scenario.Status, event) {
+		if isStreamSource(scenario.VideoSource) {
+			http.Error(w, "Frames of a live stream can not be replayed", http.StatusBadRequest)
+			return
+		}
 
-				return nil
-			}); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
+		replay, err := parseReplayRange(r.URL.Query(), scenario)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		trigger.Payload.Replay = &replay
+	}
 
-			newStatus = models.StatusInitShutdown
-		case models.StatusInStartupProcessing, models.StatusActive:
-			if err := h.db.InTx(ctx, func(ctx context.Context) error {
-				err = h.db.UpdateScenarioStatus(ctx, scenarioID, models.StatusInitShutdown)
-				if err != nil {
-					return err
-				}
-				return h.db.AddToOutbox(ctx, scenarioID, models.CommandStop)
-			}); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+	var newStatus models.ScenarioStatus
+	err = h.db.InTx(ctx, func(ctx context.Context) error {
+		if trigger.Payload.Replay != nil {
+			// Результаты повторного прогона пишутся в новую версию, прежние остаются для сравнения
+			version, err := h.db.NextResultVersion(ctx, scenarioID)
+			if err != nil {
+				return err
 			}
+			trigger.Payload.Replay.ResultVersion = version
+			trigger.Cause = fmt.Sprintf("replay of frames %d..%d requested as result version %d",
+				trigger.Payload.Replay.FromFrame, trigger.Payload.Replay.ToFrame, version)
+		}
 
-			newStatus = models.StatusInitShutdown
+		newStatus, err = h.machine.Fire(ctx, scenarioID, trigger)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, statemachine.ErrInvalidTransition) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		return
 	}
 	log.Println(action, newStatus)
 
 	// Возвращаем обновленный статус
 	response := map[string]string{"id": scenarioID, "status": string(newStatus)}
+	if trigger.Payload.Replay != nil {
+		response["result_version"] = strconv.Itoa(trigger.Payload.Replay.ResultVersion)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
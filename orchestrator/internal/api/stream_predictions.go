@@ -0,0 +1,259 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/gorilla/mux"
+)
+
+const (
+	streamKeepAlive = 15 * time.Second
+	// streamCatchUp через сколько после подписки повторно проверить S3: подписка MinIO
+	// устанавливается асинхронно, и кадры, записанные до неё, не придут уведомлением
+	streamCatchUp = 2 * time.Second
+	// streamSentWindow сколько последних отправленных кадров помнит подключение. Живой поток
+	// не заканчивается, и хранить хеши всех его кадров нельзя
+	streamSentWindow = 4096
+)
+
+// StreamPredictionsHandler отправляет результаты детекции по Server-Sent Events.
+// Сначала отдаются уже сохранённые кадры начиная с from_frame, затем новые по мере их записи раннером.
+// id события - индекс кадра, поэтому после переподключения EventSource продолжит с кадра,
+// следующего за Last-Event-ID. Параметр version выбирает версию результатов, как в GetPredictionsHandler
+func (h *Handlers) StreamPredictionsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scenarioID := vars["scenario_id"]
+
+	fromFrame := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		last, err := strconv.Atoi(v)
+		if err != nil || last < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		fromFrame = last + 1
+	} else if v := r.URL.Query().Get("from_frame"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "from_frame must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		fromFrame = n
+	}
+
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "version must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		version = n
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.db.GetScenarioByID(scenarioID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Scenario not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ctx := r.Context()
+	// Подписываемся до чтения сохранённых кадров, чтобы не пропустить записанные во время replay
+	events := h.s3.ListenPredictions(ctx, scenarioID, version)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	s := &predictionStream{
+		h:          h,
+		w:          w,
+		flusher:    flusher,
+		scenarioID: scenarioID,
+		fromFrame:  fromFrame,
+		version:    version,
+		sent:       make(map[int]uint64),
+	}
+
+	if err := s.replay(ctx); err != nil {
+		log.Printf("Stream predictions %s: replay failed: %v", scenarioID, err)
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	catchUp := time.After(streamCatchUp)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-catchUp:
+			if err := s.replay(ctx); err != nil {
+				log.Printf("Stream predictions %s: catch-up failed: %v", scenarioID, err)
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Err != nil {
+				log.Printf("Stream predictions %s: subscription failed: %v", scenarioID, event.Err)
+				s.send("error", "", map[string]string{"message": "prediction subscription failed"})
+				return
+			}
+			if err := s.live(ctx, event.Frame); err != nil {
+				log.Printf("Stream predictions %s: %v", scenarioID, err)
+				return
+			}
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// predictionStream состояние одного SSE подключения
+type predictionStream struct {
+	h          *Handlers
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	scenarioID string
+	fromFrame  int
+	version    int
+	// sent хеш содержимого отправленных кадров. Повторная проверка S3 не отправляет кадры заново,
+	// а уведомление отправляет кадр, только если его результаты изменились, например после reprocess_failed
+	sent map[int]uint64
+	// sentBelow кадры до него считаются отправленными, их хеши уже забыты.
+	// Уведомление о таком кадре отправляется без сравнения с прежним содержимым
+	sentBelow int
+}
+
+// replay отправляет сохранённые в S3 кадры, которые ещё не были отправлены
+func (s *predictionStream) replay(ctx context.Context) error {
+	frames, err := s.h.s3.ListPredictionFrames(ctx, s.scenarioID, s.version)
+	if err != nil {
+		return err
+	}
+	frames = slices.DeleteFunc(frames[sort.SearchInts(frames, s.fromFrame):], func(frame int) bool {
+		_, ok := s.sent[frame]
+		return ok || frame < s.sentBelow
+	})
+
+	for len(frames) > 0 {
+		batch := frames[:min(len(frames), defaultPredictionsLimit)]
+		frames = frames[len(batch):]
+
+		predictions, err := s.h.fetchPredictions(ctx, s.scenarioID, s.version, batch)
+		if err != nil {
+			return err
+		}
+		for _, prediction := range predictions {
+			if err := s.sendPrediction(prediction); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// live отправляет кадр, о записи которого пришло уведомление
+func (s *predictionStream) live(ctx context.Context, frame int) error {
+	if frame < s.fromFrame {
+		return nil
+	}
+
+	detections, err := s.h.s3.GetPrediction(ctx, s.scenarioID, s.version, frame)
+	if err != nil {
+		return err
+	}
+	return s.sendPrediction(models.FramePrediction{Frame: frame, Detections: detections})
+}
+
+// sendPrediction отправляет кадр, если он ещё не был отправлен с тем же содержимым
+func (s *predictionStream) sendPrediction(prediction models.FramePrediction) error {
+	data, err := json.Marshal(prediction)
+	if err != nil {
+		return err
+	}
+	hash := fnv.New64a()
+	hash.Write(data)
+	sum := hash.Sum64()
+	if prev, ok := s.sent[prediction.Frame]; ok && prev == sum {
+		return nil
+	}
+
+	if err := s.write("prediction", strconv.Itoa(prediction.Frame), data); err != nil {
+		return err
+	}
+	if prediction.Frame >= s.sentBelow {
+		s.sent[prediction.Frame] = sum
+		s.forgetOldest()
+	}
+	return nil
+}
+
+// forgetOldest оставляет хеши streamSentWindow последних кадров, когда их накопилось вдвое больше.
+// Кадры до первого оставшегося считаются отправленными
+func (s *predictionStream) forgetOldest() {
+	if len(s.sent) <= 2*streamSentWindow {
+		return
+	}
+
+	frames := slices.Sorted(maps.Keys(s.sent))
+	s.sentBelow = frames[len(frames)-streamSentWindow]
+	for _, frame := range frames[:len(frames)-streamSentWindow] {
+		delete(s.sent, frame)
+	}
+}
+
+func (s *predictionStream) send(event, id string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.write(event, id, data)
+}
+
+func (s *predictionStream) write(event, id string, data []byte) error {
+	if id != "" {
+		if _, err := fmt.Fprintf(s.w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
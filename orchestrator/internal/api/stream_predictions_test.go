@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+// TestPredictionStreamForgetsOldFrames подключение к живому потоку помнит ограниченное число кадров
+func TestPredictionStreamForgetsOldFrames(t *testing.T) {
+	w := httptest.NewRecorder()
+	s := &predictionStream{w: w, flusher: w, sent: make(map[int]uint64)}
+
+	frames := 3 * streamSentWindow
+	for frame := range frames {
+		if err := s.sendPrediction(models.FramePrediction{Frame: frame}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.sent) > 2*streamSentWindow {
+		t.Errorf("stream remembers %d frames, want at most %d", len(s.sent), 2*streamSentWindow)
+	}
+	if s.sentBelow == 0 {
+		t.Error("forgotten frames are not marked as sent")
+	}
+
+	// Кадр из окна с тем же содержимым повторно не отправляется, а забытый отправляется
+	w.Body.Reset()
+	if err := s.sendPrediction(models.FramePrediction{Frame: frames - 1}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("unchanged frame was sent again: %q", w.Body.String())
+	}
+	if err := s.sendPrediction(models.FramePrediction{Frame: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), "id: 0\n") {
+		t.Errorf("notification about a forgotten frame was not sent: %q", w.Body.String())
+	}
+}
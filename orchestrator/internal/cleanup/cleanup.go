@@ -0,0 +1,145 @@
+package cleanup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/s3"
+)
+
+const (
+	cleanupInterval = 10 * time.Second
+	// runnerTimeout сколько ждать подтверждения раннера после отправки команды удаления,
+	// прежде чем удалять данные без него
+	runnerTimeout = 2 * time.Minute
+	// errDeleteCommandDead ошибка удаления, пока мёртвую команду удаления не поставят в очередь заново
+	errDeleteCommandDead = "delete command was not sent to runners, requeue it via POST /admin/outbox/{message_id}/requeue"
+)
+
+// Cleaner в фоне удаляет кадры, результаты и записи сценариев в статусе deleting
+type Cleaner struct {
+	db *database.Database
+	s3 *s3.Client
+}
+
+func New(db *database.Database, s3Client *s3.Client) *Cleaner {
+	return &Cleaner{
+		db: db,
+		s3: s3Client,
+	}
+}
+
+func (c *Cleaner) Start(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Cleanup stopped")
+			return
+		case <-ticker.C:
+			c.cleanScenarios(ctx)
+		}
+	}
+}
+
+func (c *Cleaner) cleanScenarios(ctx context.Context) {
+	scenarios, err := c.db.GetDeletingScenarios(ctx)
+	if err != nil {
+		log.Printf("Cleanup: failed to get deleting scenarios: %v", err)
+		return
+	}
+
+	for _, scenario := range scenarios {
+		if err := c.clean(ctx, scenario); err != nil {
+			log.Printf("Cleanup: scenario %s: %v", scenario.ID, err)
+		}
+	}
+}
+
+// clean удаляет данные сценария. Раннеры должны сначала остановить его,
+// иначе новые результаты появятся уже после очистки
+func (c *Cleaner) clean(ctx context.Context, scenario models.Scenario) error {
+	progress := models.DeletionProgress{RequestedAt: scenario.UpdatedAt}
+	if scenario.Deletion != nil {
+		progress = *scenario.Deletion
+	}
+	progress.Error = ""
+
+	if !progress.RunnerDone {
+		sentAt, dead, err := c.deleteCommandSentAt(ctx, scenario.ID, progress.RequestedAt)
+		if err != nil {
+			return err
+		}
+		if sentAt == nil {
+			// Команда удаления ещё не дошла до раннеров: без неё сценарий может продолжать работать,
+			// а её строка outbox должна остаться доступной для повторной отправки
+			if dead {
+				progress.Error = errDeleteCommandDead
+			}
+			if scenario.Deletion == nil || scenario.Deletion.Error != progress.Error {
+				c.saveProgress(ctx, scenario.ID, progress)
+			}
+			return nil
+		}
+		if time.Since(*sentAt) < runnerTimeout {
+			return nil
+		}
+		log.Printf("Cleanup: no delete confirmation from runners for scenario %s, deleting anyway", scenario.ID)
+	}
+
+	prefixes := []struct {
+		bucket string
+		count  *int
+	}{
+		{s3.FramesBucket, &progress.FramesDeleted},
+		{s3.PredictionsBucket, &progress.PredictionsDeleted},
+		// Видео, из которого не удалось извлечь кадры, могло остаться после ingest_failed
+		{s3.UploadsBucket, new(int)},
+	}
+	for _, prefix := range prefixes {
+		err := c.s3.RemovePrefix(ctx, prefix.bucket, scenario.ID+"/", func(n int) {
+			*prefix.count += n
+			c.saveProgress(ctx, scenario.ID, progress)
+		})
+		if err != nil {
+			progress.Error = err.Error()
+			c.saveProgress(ctx, scenario.ID, progress)
+			return fmt.Errorf("failed to remove objects from %s: %w", prefix.bucket, err)
+		}
+	}
+
+	if err := c.db.DeleteScenarioData(ctx, scenario.ID); err != nil {
+		return fmt.Errorf("failed to delete scenario rows: %w", err)
+	}
+
+	log.Printf("Cleanup: scenario %s deleted, %d frames and %d predictions removed",
+		scenario.ID, progress.FramesDeleted, progress.PredictionsDeleted)
+	return nil
+}
+
+// deleteCommandSentAt возвращает время отправки команды удаления раннерам, nil пока она не отправлена,
+// и признак того, что команда мёртвая. Сценарии без команды удаления ждут от момента запроса
+func (c *Cleaner) deleteCommandSentAt(ctx context.Context, scenarioID string, requestedAt time.Time) (*time.Time, bool, error) {
+	sentAt, dead, err := c.db.GetDeleteCommandState(ctx, scenarioID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &requestedAt, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get delete command state: %w", err)
+	}
+	return sentAt, dead, nil
+}
+
+func (c *Cleaner) saveProgress(ctx context.Context, scenarioID string, progress models.DeletionProgress) {
+	if err := c.db.SaveDeletionProgress(ctx, scenarioID, progress); err != nil {
+		log.Printf("Cleanup: failed to save progress of scenario %s: %v", scenarioID, err)
+	}
+}
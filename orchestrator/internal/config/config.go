@@ -26,6 +26,21 @@ type Config struct {
 		ScenarioTopic  string   `yaml:"scenario_topic" env:"SCENARIO_TOPIC"`
 		HeartbeatTopic string   `yaml:"heartbeat_topic" env:"HEARTBEAT_TOPIC"`
 	} `yaml:"kafka"`
+
+	Outbox struct {
+		MaxAttempts int `yaml:"max_attempts" env:"OUTBOX_MAX_ATTEMPTS"`
+	} `yaml:"outbox"`
+
+	Ingest struct {
+		Workers int `yaml:"workers" env:"INGEST_WORKERS"`
+	} `yaml:"ingest"`
+
+	Retention struct {
+		FramesDays      int  `yaml:"frames_days" env:"RETENTION_FRAMES_DAYS"`
+		PredictionsDays int  `yaml:"predictions_days" env:"RETENTION_PREDICTIONS_DAYS"`
+		HeartbeatsDays  int  `yaml:"heartbeats_days" env:"RETENTION_HEARTBEATS_DAYS"`
+		DryRun          bool `yaml:"dry_run" env:"RETENTION_DRY_RUN"`
+	} `yaml:"retention"`
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
@@ -9,6 +10,8 @@ import (
 // Database represents the database connection and operations
 type Database struct {
 	DB *sql.DB
+	// dsn нужен для отдельных соединений LISTEN
+	dsn string
 }
 
 // New creates a new Database instance
@@ -23,7 +26,7 @@ func New(dsn string) (*Database, error) {
 		return nil, err
 	}
 
-	return &Database{DB: db}, nil
+	return &Database{DB: db, dsn: dsn}, nil
 }
 
 // Init creates the required tables if they don't exist
@@ -36,28 +39,125 @@ func (d *Database) Init() error {
 		created_at TIMESTAMP NOT NULL,
 		updated_at TIMESTAMP NOT NULL
 	);
-	
+
+	CREATE TABLE IF NOT EXISTS outbox (
+		id TEXT PRIMARY KEY,
+		scenario_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		processed_at TIMESTAMP,
+		FOREIGN KEY (scenario_id) REFERENCES scenarios(id)
+	);
+
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS payload JSONB NOT NULL DEFAULT '{}';
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP;
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS last_error TEXT;
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_at TIMESTAMP;
+	-- Диспетчер выбирает неотправленные команды по одной, выборка не должна читать всю историю outbox
+	CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (created_at) WHERE processed_at IS NULL;
+	CREATE INDEX IF NOT EXISTS outbox_pending_scenario_idx ON outbox (scenario_id, created_at) WHERE processed_at IS NULL;
+
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS ingest_source TEXT;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS ingest_error TEXT;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS extraction JSONB;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS video_metadata JSONB;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS result_version INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS deletion JSONB;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS frames_purged_at TIMESTAMP;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS predictions_purged_at TIMESTAMP;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS last_heartbeat_at TIMESTAMP;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS last_frame BIGINT;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS processed_frames BIGINT;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS total_frames BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS fps DOUBLE PRECISION NOT NULL DEFAULT 0;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS ingest_renewed_at TIMESTAMP;
+	CREATE INDEX IF NOT EXISTS scenarios_last_heartbeat_idx ON scenarios (status, last_heartbeat_at);
+
+	-- Прежняя несекционированная таблица heartbeats переносится в агрегаты ниже
+	DO $$
+	BEGIN
+		IF (SELECT relkind FROM pg_class WHERE oid = to_regclass('heartbeats')) = 'r' THEN
+			ALTER TABLE heartbeats RENAME TO heartbeats_legacy;
+		END IF;
+	END $$;
+
 	CREATE TABLE IF NOT EXISTS heartbeats (
-		id SERIAL PRIMARY KEY,
+		id BIGSERIAL,
 		scenario_id TEXT NOT NULL,
 		status TEXT NOT NULL,
 		frame INTEGER NOT NULL,
 		timestamp TIMESTAMP NOT NULL,
-		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id, created_at)
+	) PARTITION BY RANGE (created_at);
+	-- Heartbeats не теряются, даже если суточная секция не была создана заранее
+	CREATE TABLE IF NOT EXISTS heartbeats_default PARTITION OF heartbeats DEFAULT;
+
+	CREATE TABLE IF NOT EXISTS heartbeat_rollups (
+		scenario_id TEXT NOT NULL,
+		minute TIMESTAMP NOT NULL,
+		status TEXT NOT NULL,
+		heartbeats INTEGER NOT NULL,
+		min_frame INTEGER NOT NULL,
+		max_frame INTEGER NOT NULL,
+		PRIMARY KEY (scenario_id, minute, status)
 	);
 
-	CREATE TABLE IF NOT EXISTS outbox (
-		id TEXT PRIMARY KEY,
+	DO $$
+	BEGIN
+		IF to_regclass('heartbeats_legacy') IS NOT NULL THEN
+			INSERT INTO heartbeat_rollups (scenario_id, minute, status, heartbeats, min_frame, max_frame)
+			SELECT scenario_id, date_trunc('minute', timestamp), status, COUNT(*), MIN(frame), MAX(frame)
+			FROM heartbeats_legacy
+			GROUP BY 1, 2, 3
+			ON CONFLICT DO NOTHING;
+
+			UPDATE scenarios s SET last_heartbeat_at = h.timestamp, last_frame = h.frame
+			FROM (
+				SELECT DISTINCT ON (scenario_id) scenario_id, timestamp, frame
+				FROM heartbeats_legacy
+				ORDER BY scenario_id, timestamp DESC
+			) h
+			WHERE s.id = h.scenario_id AND s.last_heartbeat_at IS NULL;
+
+			DROP TABLE heartbeats_legacy;
+		END IF;
+	END $$;
+
+	CREATE TABLE IF NOT EXISTS failed_frames (
 		scenario_id TEXT NOT NULL,
-		action TEXT NOT NULL,
+		frame INTEGER NOT NULL,
+		error TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (scenario_id, frame),
+		FOREIGN KEY (scenario_id) REFERENCES scenarios(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS scenario_transitions (
+		id BIGSERIAL PRIMARY KEY,
+		scenario_id TEXT NOT NULL,
+		from_status TEXT,
+		to_status TEXT NOT NULL,
+		event TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		cause TEXT NOT NULL,
 		created_at TIMESTAMP NOT NULL,
-		processed_at TIMESTAMP,
 		FOREIGN KEY (scenario_id) REFERENCES scenarios(id)
 	);
+	CREATE INDEX IF NOT EXISTS scenario_transitions_scenario_idx ON scenario_transitions (scenario_id, id);
+
+	CREATE INDEX IF NOT EXISTS scenarios_created_at_idx ON scenarios (created_at, id);
+	CREATE INDEX IF NOT EXISTS scenarios_updated_at_idx ON scenarios (updated_at, id);
+	CREATE INDEX IF NOT EXISTS scenarios_status_idx ON scenarios (status);
 	`
 
-	_, err := d.DB.Exec(createTables)
-	return err
+	if _, err := d.DB.Exec(createTables); err != nil {
+		return err
+	}
+
+	return d.EnsureHeartbeatPartitions(context.Background(), HeartbeatPartitionsAhead)
 }
 
 // Close closes the database connection
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+// StartDeletion resets the deletion progress of a scenario that has just been marked for deletion
+func (d *Database) StartDeletion(ctx context.Context, scenarioID string) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		"UPDATE scenarios SET deletion = $1 WHERE id = $2",
+		jsonColumn{&models.DeletionProgress{RequestedAt: time.Now().UTC()}},
+		scenarioID,
+	)
+
+	return err
+}
+
+// SaveDeletionProgress stores the progress of the background cleanup
+func (d *Database) SaveDeletionProgress(ctx context.Context, scenarioID string, progress models.DeletionProgress) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		"UPDATE scenarios SET deletion = $1 WHERE id = $2 AND status = $3",
+		jsonColumn{&progress},
+		scenarioID,
+		models.StatusDeleting,
+	)
+
+	return err
+}
+
+// MarkRunnerDeleted records that runners have stopped the scenario and removed their rows
+func (d *Database) MarkRunnerDeleted(ctx context.Context, scenarioID string) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		`UPDATE scenarios SET deletion = jsonb_set(deletion, '{runner_done}', 'true')
+		WHERE id = $1 AND status = $2 AND deletion IS NOT NULL`,
+		scenarioID,
+		models.StatusDeleting,
+	)
+
+	return err
+}
+
+// GetDeleteCommandState returns when the latest delete command of a scenario was sent to runners,
+// nil while it is pending or dead. Returns sql.ErrNoRows if the scenario has no delete command
+func (d *Database) GetDeleteCommandState(ctx context.Context, scenarioID string) (sentAt *time.Time, dead bool, err error) {
+	err = d.querier(ctx).QueryRowContext(ctx, `
+		SELECT processed_at, dead_at IS NOT NULL FROM outbox
+		WHERE scenario_id = $1 AND action = $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, scenarioID, models.CommandDelete).Scan(&sentAt, &dead)
+
+	return sentAt, dead, err
+}
+
+// GetDeletingScenarios retrieves scenarios waiting for the background cleanup
+func (d *Database) GetDeletingScenarios(ctx context.Context) ([]models.Scenario, error) {
+	rows, err := d.querier(ctx).QueryContext(ctx,
+		"SELECT "+scenarioColumns+" FROM scenarios WHERE status = $1 ORDER BY updated_at",
+		models.StatusDeleting,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scenarios []models.Scenario
+	for rows.Next() {
+		s, err := scanScenario(rows)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	return scenarios, rows.Err()
+}
+
+// DeleteScenarioData removes the scenario together with its heartbeats, commands, failed frames and history
+func (d *Database) DeleteScenarioData(ctx context.Context, scenarioID string) error {
+	return d.InTx(ctx, func(ctx context.Context) error {
+		// Сценарий удаляется последним: на него ссылаются остальные таблицы
+		for _, table := range []string{"heartbeats", "heartbeat_rollups", "outbox", "failed_frames", "scenario_transitions", "scenarios"} {
+			column := "scenario_id"
+			if table == "scenarios" {
+				column = "id"
+			}
+
+			query := fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, column)
+			if _, err := d.querier(ctx).ExecContext(ctx, query, scenarioID); err != nil {
+				return fmt.Errorf("delete from %s: %w", table, err)
+			}
+		}
+
+		return nil
+	})
+}
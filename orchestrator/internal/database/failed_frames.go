@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/lib/pq"
+)
+
+// RecordFrameFailures saves frames the runner failed to process, accumulating attempts across runs
+func (d *Database) RecordFrameFailures(ctx context.Context, scenarioID string, failures []models.FrameFailure) error {
+	for _, f := range failures {
+		_, err := d.querier(ctx).ExecContext(ctx, `
+			INSERT INTO failed_frames (scenario_id, frame, error, attempts, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (scenario_id, frame) DO UPDATE
+			SET error = EXCLUDED.error,
+			    attempts = failed_frames.attempts + EXCLUDED.attempts,
+			    updated_at = EXCLUDED.updated_at
+		`, scenarioID, f.Frame, f.Error, f.Attempts, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClearFrameFailures removes frames that were successfully reprocessed
+func (d *Database) ClearFrameFailures(ctx context.Context, scenarioID string, frames []int64) error {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	_, err := d.querier(ctx).ExecContext(ctx,
+		"DELETE FROM failed_frames WHERE scenario_id = $1 AND frame = ANY($2)",
+		scenarioID,
+		pq.Array(frames),
+	)
+
+	return err
+}
+
+// GetFrameFailures returns failed frames of a scenario ordered by frame index
+func (d *Database) GetFrameFailures(ctx context.Context, scenarioID string) ([]models.FrameFailure, error) {
+	rows, err := d.querier(ctx).QueryContext(ctx,
+		"SELECT frame, error, attempts FROM failed_frames WHERE scenario_id = $1 ORDER BY frame",
+		scenarioID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []models.FrameFailure{}
+	for rows.Next() {
+		var f models.FrameFailure
+		if err := rows.Scan(&f.Frame, &f.Error, &f.Attempts); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+
+	return failures, rows.Err()
+}
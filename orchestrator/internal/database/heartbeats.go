@@ -2,35 +2,62 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/lib/pq"
 )
 
-// WriteHeartbeat record a heartbeat
-func (d *Database) WriteHeartbeat(heartbeat models.Heartbeat) error {
-	_, err := d.DB.Exec(
-		"INSERT INTO heartbeats (scenario_id, status, frame, timestamp) VALUES ($1, $2, $3, $4)",
-		heartbeat.ScenarioID,
-		heartbeat.Action,
-		heartbeat.Frame,
-		heartbeat.TimeStamp,
-	)
+// WriteHeartbeat records a heartbeat and updates the last heartbeat summary of the scenario
+func (d *Database) WriteHeartbeat(ctx context.Context, heartbeat models.Heartbeat) error {
+	return d.InTx(ctx, func(ctx context.Context) error {
+		if _, err := d.querier(ctx).ExecContext(ctx,
+			"INSERT INTO heartbeats (scenario_id, status, frame, timestamp) VALUES ($1, $2, $3, $4)",
+			heartbeat.ScenarioID,
+			heartbeat.Action,
+			heartbeat.Frame,
+			heartbeat.TimeStamp,
+		); err != nil {
+			return err
+		}
 
-	return err
+		// Heartbeats могут прийти не по порядку, сводка не должна откатываться назад
+		_, err := d.querier(ctx).ExecContext(ctx,
+			`UPDATE scenarios SET last_heartbeat_at = $1, last_frame = $2
+			WHERE id = $3 AND (last_heartbeat_at IS NULL OR last_heartbeat_at <= $1)`,
+			heartbeat.TimeStamp,
+			heartbeat.Frame,
+			heartbeat.ScenarioID,
+		)
+		if err != nil || !heartbeat.HasProgress() {
+			return err
+		}
+
+		_, err = d.querier(ctx).ExecContext(ctx,
+			`UPDATE scenarios SET processed_frames = $1, total_frames = $2, fps = $3
+			WHERE id = $4 AND last_heartbeat_at <= $5`,
+			heartbeat.ProcessedFrames(),
+			heartbeat.TotalFrames,
+			heartbeat.FPS,
+			heartbeat.ScenarioID,
+			heartbeat.TimeStamp,
+		)
+		return err
+	})
 }
 
-func (d *Database) FindStuckScenarios(ctx context.Context, interval time.Duration) ([]models.Scenario, error) {
+// FindStuckScenarios returns scenarios in one of the statuses without heartbeats for the interval.
+// Время отсчитывается от последнего heartbeat или от перехода в статус, если он был позже:
+// heartbeat прошлого прогона не должен делать только что запущенный сценарий зависшим
+func (d *Database) FindStuckScenarios(ctx context.Context, interval time.Duration, statuses ...models.ScenarioStatus) ([]models.Scenario, error) {
 	rows, err := d.DB.QueryContext(ctx, `
-		SELECT s.id, s.status, s.video_source, s.created_at, s.updated_at
-		FROM scenarios s
-		LEFT JOIN (
-			SELECT scenario_id, MAX(timestamp) as last_heartbeat
-			FROM heartbeats
-			GROUP BY scenario_id
-		) h ON s.id = h.scenario_id
-		WHERE s.status = $1 AND (h.last_heartbeat IS NULL OR h.last_heartbeat < $2)
-	`, models.StatusActive, time.Now().Add(-interval))
+		SELECT id, status, video_source, created_at, updated_at
+		FROM scenarios
+		WHERE status = ANY($1) AND GREATEST(COALESCE(last_heartbeat_at, updated_at), updated_at) < $2
+	`, pq.Array(statuses), time.Now().Add(-interval))
 
 	if err != nil {
 		return nil, err
@@ -55,3 +82,146 @@ func (d *Database) FindStuckScenarios(ctx context.Context, interval time.Duratio
 
 	return scenarios, nil
 }
+
+// HeartbeatPartitionsAhead на сколько дней вперёд создаются секции heartbeats
+const HeartbeatPartitionsAhead = 7
+
+// heartbeatPartitionsInterval как часто проверяются секции heartbeats
+const heartbeatPartitionsInterval = time.Hour
+
+// EnsureHeartbeatPartitions creates daily heartbeats partitions from today up to days ahead.
+// Heartbeats, попавшие в секцию по умолчанию, пока суточной секции не было, переносятся в созданную секцию:
+// иначе Postgres не даст создать секцию, пересекающуюся со строками секции по умолчанию
+func (d *Database) EnsureHeartbeatPartitions(ctx context.Context, days int) error {
+	_, err := d.querier(ctx).ExecContext(ctx, fmt.Sprintf(`
+	DO $$
+	DECLARE
+		day DATE;
+		part TEXT;
+	BEGIN
+		-- Параллельные вызовы с разных экземпляров выполняются по очереди, вставки в секцию по умолчанию ждут переноса
+		LOCK TABLE heartbeats_default IN SHARE ROW EXCLUSIVE MODE;
+
+		FOR day IN
+			SELECT generate_series(
+				LEAST(CURRENT_DATE, (SELECT MIN(created_at)::date FROM heartbeats_default)),
+				CURRENT_DATE + %d,
+				interval '1 day'
+			)::date
+		LOOP
+			part := 'heartbeats_p' || to_char(day, 'YYYYMMDD');
+			CONTINUE WHEN to_regclass(part) IS NOT NULL;
+
+			EXECUTE format('CREATE TABLE %%I (LIKE heartbeats INCLUDING DEFAULTS)', part);
+			EXECUTE format(
+				'WITH moved AS (DELETE FROM heartbeats_default WHERE created_at >= %%L AND created_at < %%L RETURNING *) INSERT INTO %%I SELECT * FROM moved',
+				day, day + 1, part
+			);
+			EXECUTE format('ALTER TABLE heartbeats ATTACH PARTITION %%I FOR VALUES FROM (%%L) TO (%%L)', part, day, day + 1);
+		END LOOP;
+	END $$;`, days))
+
+	return err
+}
+
+// MaintainHeartbeatPartitions periodically creates heartbeats partitions ahead of time.
+// Не зависит от GC и сроков хранения: без секций heartbeats попадали бы в секцию по умолчанию
+func (d *Database) MaintainHeartbeatPartitions(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatPartitionsInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.EnsureHeartbeatPartitions(ctx, HeartbeatPartitionsAhead); err != nil {
+			log.Printf("Failed to create heartbeat partitions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HeartbeatPartition daily partition of the heartbeats table
+type HeartbeatPartition struct {
+	Name string
+	Day  time.Time
+}
+
+// GetHeartbeatPartitionsBefore returns partitions holding only heartbeats received before the given day
+func (d *Database) GetHeartbeatPartitionsBefore(ctx context.Context, before time.Time) ([]HeartbeatPartition, error) {
+	rows, err := d.querier(ctx).QueryContext(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'heartbeats'::regclass
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []HeartbeatPartition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		day, err := time.Parse("20060102", strings.TrimPrefix(name, "heartbeats_p"))
+		if err != nil {
+			// Секция создана не EnsureHeartbeatPartitions
+			continue
+		}
+		if day.AddDate(0, 0, 1).After(before) {
+			continue
+		}
+		partitions = append(partitions, HeartbeatPartition{Name: name, Day: day})
+	}
+
+	return partitions, rows.Err()
+}
+
+// CountHeartbeats returns the number of heartbeats in the partition
+func (d *Database) CountHeartbeats(ctx context.Context, partition HeartbeatPartition) (int64, error) {
+	var count int64
+	err := d.querier(ctx).QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM "+pq.QuoteIdentifier(partition.Name),
+	).Scan(&count)
+
+	return count, err
+}
+
+// RollupHeartbeatPartition aggregates heartbeats of the partition per scenario, minute and status
+// into heartbeat_rollups and drops the partition. Returns the number of aggregated heartbeats
+func (d *Database) RollupHeartbeatPartition(ctx context.Context, partition HeartbeatPartition) (int64, error) {
+	var count int64
+	err := d.InTx(ctx, func(ctx context.Context) error {
+		table := pq.QuoteIdentifier(partition.Name)
+		// Минута по времени раннера может попасть в соседнюю секцию, агрегаты складываются
+		if _, err := d.querier(ctx).ExecContext(ctx, `
+			INSERT INTO heartbeat_rollups (scenario_id, minute, status, heartbeats, min_frame, max_frame)
+			SELECT scenario_id, date_trunc('minute', timestamp), status, COUNT(*), MIN(frame), MAX(frame)
+			FROM `+table+`
+			GROUP BY 1, 2, 3
+			ON CONFLICT (scenario_id, minute, status) DO UPDATE SET
+				heartbeats = heartbeat_rollups.heartbeats + EXCLUDED.heartbeats,
+				min_frame = LEAST(heartbeat_rollups.min_frame, EXCLUDED.min_frame),
+				max_frame = GREATEST(heartbeat_rollups.max_frame, EXCLUDED.max_frame)`,
+		); err != nil {
+			return fmt.Errorf("rollup %s: %w", partition.Name, err)
+		}
+
+		if err := d.querier(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			return err
+		}
+
+		if _, err := d.querier(ctx).ExecContext(ctx, "DROP TABLE "+table); err != nil {
+			return fmt.Errorf("drop %s: %w", partition.Name, err)
+		}
+		return nil
+	})
+
+	return count, err
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// jsonColumn сохраняет значение в nullable JSONB колонку и читает его обратно.
+// nil указатель соответствует NULL
+type jsonColumn struct {
+	v any
+}
+
+// Value реализует driver.Valuer
+func (c jsonColumn) Value() (driver.Value, error) {
+	if c.v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(c.v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, nil
+	}
+	return json.Marshal(c.v)
+}
+
+// Scan реализует sql.Scanner, c.v должен быть указателем на приёмник
+func (c jsonColumn) Scan(src any) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, c.v)
+	case string:
+		return json.Unmarshal([]byte(data), c.v)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", src)
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// AdvisoryLock сессионная advisory блокировка Postgres. Она держится, пока открыто
+// выделенное под неё соединение, и снимается сервером, если процесс упал
+type AdvisoryLock struct {
+	conn *sql.Conn
+	name string
+}
+
+// TryAdvisoryLock tries to take the lock named name without waiting.
+// Returns nil if the lock is held by another session
+func (d *Database) TryAdvisoryLock(ctx context.Context, name string) (*AdvisoryLock, error) {
+	conn, err := d.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, nil
+	}
+
+	return &AdvisoryLock{conn: conn, name: name}, nil
+}
+
+// lockQueryTimeout ограничивает запросы по соединению блокировки: на полуоткрытом TCP соединении
+// запрос без дедлайна может висеть бесконечно
+const lockQueryTimeout = 3 * time.Second
+
+// ErrLockLost the session no longer holds the advisory lock
+var ErrLockLost = errors.New("advisory lock is not held")
+
+// Check verifies that the lock connection is alive and this session still holds the lock
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, lockQueryTimeout)
+	defer cancel()
+
+	// pg_advisory_lock(bigint) хранит старшие 32 бита ключа в classid, младшие в objid
+	var held bool
+	err := l.conn.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted AND objsubid = 1
+				AND ((classid::bigint << 32) | objid::bigint) = hashtext($1)::bigint
+		)
+	`, l.name).Scan(&held)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release releases the lock and closes its connection
+func (l *AdvisoryLock) Release() {
+	ctx, cancel := context.WithTimeout(context.Background(), lockQueryTimeout)
+	defer cancel()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", l.name); err != nil {
+		log.Printf("Failed to release advisory lock %s: %v", l.name, err)
+	}
+	l.conn.Close()
+}
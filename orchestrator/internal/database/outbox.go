@@ -2,60 +2,242 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // AddToOutbox adds a message to the transactional outbox
 func (d *Database) AddToOutbox(ctx context.Context, scenarioID string, action models.CommandAction) error {
-	_, err := d.querier(ctx).Exec(
-		"INSERT INTO outbox (id, scenario_id, action, created_at) VALUES ($1, $2, $3, $4)",
+	return d.AddCommandToOutbox(ctx, scenarioID, action, models.CommandPayload{})
+}
+
+// AddCommandToOutbox adds a message with additional command parameters to the transactional outbox
+func (d *Database) AddCommandToOutbox(ctx context.Context, scenarioID string, action models.CommandAction, payload models.CommandPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command payload: %w", err)
+	}
+
+	_, err = d.querier(ctx).ExecContext(ctx,
+		"INSERT INTO outbox (id, scenario_id, action, payload, created_at) VALUES ($1, $2, $3, $4, $5)",
 		uuid.New().String(),
 		scenarioID,
 		action,
+		data,
 		time.Now(),
 	)
+	if err != nil {
+		return err
+	}
 
+	// Уведомление доставляется слушателям после коммита транзакции
+	_, err = d.querier(ctx).ExecContext(ctx, "SELECT pg_notify($1, $2)", OutboxChannel, scenarioID)
 	return err
 }
 
-// GetPendingOutboxMessages retrieves unprocessed outbox messages
-func (d *Database) GetPendingOutboxMessages(limit int) ([]models.OutboxMessage, error) {
-	rows, err := d.DB.Query(`
+// OutboxChannel канал NOTIFY, в который AddCommandToOutbox пишет ID сценария
+const OutboxChannel = "outbox"
+
+// ListenOutbox subscribes to new outbox commands. The returned channel also fires after a reconnect,
+// because notifications sent while the connection was down are lost
+func (d *Database) ListenOutbox(ctx context.Context) (<-chan struct{}, error) {
+	listener := pq.NewListener(d.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Outbox listener: %v", err)
+		}
+	})
+	if err := listener.Listen(OutboxChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	// Несколько уведомлений до пробуждения диспетчера схлопываются в одно
+	wake := make(chan struct{}, 1)
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-listener.Notify:
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return wake, nil
+}
+
+// LockPendingOutboxMessages retrieves unprocessed outbox messages that are due to be sent and locks them
+// until the end of the transaction. Messages locked by another dispatcher are skipped.
+// Commands queued behind a dead or backed off command of the same scenario wait for it
+func (d *Database) LockPendingOutboxMessages(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	rows, err := d.querier(ctx).QueryContext(ctx, `
 		SELECT 
-			o.id, o.scenario_id, o.action, o.created_at,
+			o.id, o.scenario_id, o.action, o.payload, o.created_at,
+			o.attempts, o.next_attempt_at, COALESCE(o.last_error, ''), o.dead_at,
 			s.video_source
 		FROM outbox o
 		JOIN scenarios s ON o.scenario_id = s.id
-		WHERE o.processed_at IS NULL
+		WHERE o.processed_at IS NULL AND o.dead_at IS NULL
+			AND (o.next_attempt_at IS NULL OR o.next_attempt_at <= NOW())
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox p
+				WHERE p.scenario_id = o.scenario_id AND p.processed_at IS NULL AND p.created_at < o.created_at
+					AND (p.dead_at IS NOT NULL OR p.next_attempt_at > NOW())
+			)
 		ORDER BY o.created_at
 		LIMIT $1
+		FOR UPDATE OF o SKIP LOCKED
 	`, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messages []models.OutboxMessage
+	return scanOutboxMessages(rows)
+}
+
+// GetDeadOutboxMessages retrieves commands that ran out of attempts and were not requeued or cancelled
+func (d *Database) GetDeadOutboxMessages(ctx context.Context) ([]models.OutboxMessage, error) {
+	rows, err := d.querier(ctx).QueryContext(ctx, `
+		SELECT 
+			o.id, o.scenario_id, o.action, o.payload, o.created_at,
+			o.attempts, o.next_attempt_at, COALESCE(o.last_error, ''), o.dead_at,
+			s.video_source
+		FROM outbox o
+		JOIN scenarios s ON o.scenario_id = s.id
+		WHERE o.processed_at IS NULL AND o.dead_at IS NOT NULL
+		ORDER BY o.dead_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMessages(rows)
+}
+
+func scanOutboxMessages(rows *sql.Rows) ([]models.OutboxMessage, error) {
+	messages := []models.OutboxMessage{}
 	for rows.Next() {
 		var m models.OutboxMessage
+		var payload []byte
 		err := rows.Scan(
 			&m.ID,
 			&m.ScenarioID,
 			&m.Action,
+			&payload,
 			&m.CreatedAt,
+			&m.Attempts,
+			&m.NextAttemptAt,
+			&m.LastError,
+			&m.DeadAt,
 			&m.VideoSource,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal(payload, &m.CommandPayload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal command payload: %w", err)
+		}
 		messages = append(messages, m)
 	}
 
-	return messages, nil
+	return messages, rows.Err()
+}
+
+// GetLastRunCommand returns the latest command that started a scenario run together with its parameters.
+// Returns sql.ErrNoRows if the scenario has never been started through the outbox
+func (d *Database) GetLastRunCommand(ctx context.Context, scenarioID string) (models.CommandAction, models.CommandPayload, error) {
+	var action models.CommandAction
+	var payload []byte
+	err := d.querier(ctx).QueryRowContext(ctx, `
+		SELECT action, payload FROM outbox
+		WHERE scenario_id = $1 AND action IN ($2, $3, $4, $5)
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, scenarioID, models.CommandStart, models.CommandResume, models.CommandReprocessFailed, models.CommandReplay).Scan(&action, &payload)
+	if err != nil {
+		return "", models.CommandPayload{}, err
+	}
+
+	var p models.CommandPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return "", models.CommandPayload{}, fmt.Errorf("failed to unmarshal command payload: %w", err)
+	}
+	return action, p, nil
+}
+
+// RecordOutboxFailure counts a failed send attempt and postpones the next one by delay
+func (d *Database) RecordOutboxFailure(ctx context.Context, id string, cause string, delay time.Duration) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		"UPDATE outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = NOW() + make_interval(secs => $2) WHERE id = $3",
+		cause,
+		delay.Seconds(),
+		id,
+	)
+	return err
+}
+
+// MarkOutboxMessageDead stops sending a command that ran out of attempts. The scenario's commands
+// queued after it are cancelled: they were issued for a state the scenario has not reached
+func (d *Database) MarkOutboxMessageDead(ctx context.Context, msg models.OutboxMessage, cause string) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		"UPDATE outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = NULL, dead_at = NOW() WHERE id = $2",
+		cause,
+		msg.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.querier(ctx).ExecContext(ctx,
+		"UPDATE outbox SET processed_at = NOW() WHERE scenario_id = $1 AND processed_at IS NULL AND dead_at IS NULL",
+		msg.ScenarioID,
+	)
+	return err
+}
+
+// RequeueOutboxMessage resets attempts of a dead command so the dispatcher sends it again.
+// Returns sql.ErrNoRows if there is no such dead command
+func (d *Database) RequeueOutboxMessage(ctx context.Context, id string) (models.OutboxMessage, error) {
+	var m models.OutboxMessage
+	err := d.querier(ctx).QueryRowContext(ctx, `
+		UPDATE outbox SET attempts = 0, next_attempt_at = NULL, dead_at = NULL
+		WHERE id = $1 AND processed_at IS NULL AND dead_at IS NOT NULL
+		RETURNING id, scenario_id, action, created_at
+	`, id).Scan(&m.ID, &m.ScenarioID, &m.Action, &m.CreatedAt)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+
+	_, err = d.querier(ctx).ExecContext(ctx, "SELECT pg_notify($1, $2)", OutboxChannel, m.ScenarioID)
+	return m, err
+}
+
+// NextOutboxAttemptIn returns how long until the earliest backed off command may be retried.
+// ok is false if no command is waiting for a retry
+func (d *Database) NextOutboxAttemptIn(ctx context.Context) (delay time.Duration, ok bool, err error) {
+	var seconds sql.NullFloat64
+	err = d.querier(ctx).QueryRowContext(ctx,
+		"SELECT EXTRACT(EPOCH FROM MIN(next_attempt_at) - NOW()) FROM outbox WHERE processed_at IS NULL AND dead_at IS NULL",
+	).Scan(&seconds)
+	if err != nil || !seconds.Valid {
+		return 0, false, err
+	}
+
+	return max(time.Duration(seconds.Float64*float64(time.Second)), 0), true, nil
 }
 
 func (d *Database) MarkOutboxMessageProcessedByScenarioID(ctx context.Context, scenarioID string) (bool, error) {
@@ -87,8 +269,8 @@ func (d *Database) MarkOutboxMessageProcessedByScenarioID(ctx context.Context, s
 }
 
 // MarkOutboxMessageAsProcessed marks an outbox message as processed
-func (d *Database) MarkOutboxMessageAsProcessed(id string) error {
-	_, err := d.DB.Exec(
+func (d *Database) MarkOutboxMessageAsProcessed(ctx context.Context, id string) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
 		"UPDATE outbox SET processed_at = $1 WHERE id = $2",
 		time.Now(),
 		id,
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+// Колонки времени удаления данных сценария по сроку хранения
+const (
+	FramesPurged      = "frames_purged_at"
+	PredictionsPurged = "predictions_purged_at"
+)
+
+// GetExpiredScenarios returns ids of scenarios that became inactive before the given time
+// and whose data has not been purged since then. purged is FramesPurged or PredictionsPurged
+func (d *Database) GetExpiredScenarios(ctx context.Context, purged string, before time.Time) ([]string, error) {
+	// Перезапущенный и снова остановленный сценарий мог записать новые данные,
+	// поэтому учитывается только удаление после последней смены статуса
+	query := fmt.Sprintf(`
+		SELECT id FROM scenarios
+		WHERE status = $1 AND updated_at < $2 AND (%[1]s IS NULL OR %[1]s < updated_at)
+		ORDER BY updated_at`, purged)
+
+	rows, err := d.querier(ctx).QueryContext(ctx, query, models.StatusInactive, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// MarkPurged records when the scenario data was removed by the retention policy
+func (d *Database) MarkPurged(ctx context.Context, scenarioID, purged string) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		fmt.Sprintf("UPDATE scenarios SET %s = NOW() WHERE id = $1", purged),
+		scenarioID,
+	)
+
+	return err
+}
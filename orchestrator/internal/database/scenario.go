@@ -2,26 +2,62 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/lib/pq"
 )
 
-// GetScenarioByID retrieves a scenario by its ID
-func (d *Database) GetScenarioByID(scenarioID string) (models.Scenario, error) {
+// scenarioColumns колонки сценария в порядке scanScenario
+const scenarioColumns = `id, status, video_source, created_at, updated_at,
+	COALESCE(ingest_source, ''), COALESCE(ingest_error, ''), extraction, video_metadata, result_version, deletion,
+	frames_purged_at, predictions_purged_at, last_heartbeat_at, last_frame,
+	processed_frames, total_frames, fps`
+
+func scanScenario(row interface{ Scan(dest ...any) error }) (models.Scenario, error) {
 	var s models.Scenario
-	err := d.DB.QueryRow(
-		"SELECT id, status, video_source, created_at, updated_at FROM scenarios WHERE id = $1",
-		scenarioID,
-	).Scan(
+	var processed sql.NullInt64
+	var total int64
+	var fps float64
+	err := row.Scan(
 		&s.ID,
 		&s.Status,
 		&s.VideoSource,
 		&s.CreatedAt,
 		&s.UpdatedAt,
+		&s.IngestSource,
+		&s.IngestError,
+		jsonColumn{&s.Extraction},
+		jsonColumn{&s.Video},
+		&s.ResultVersion,
+		jsonColumn{&s.Deletion},
+		&s.FramesPurgedAt,
+		&s.PredictionsPurgedAt,
+		&s.LastHeartbeatAt,
+		&s.LastFrame,
+		&processed,
+		&total,
+		&fps,
 	)
 
+	if processed.Valid {
+		running := s.Status == models.StatusActive || s.Status == models.StatusInStartupProcessing
+		s.Progress = models.NewProgress(processed.Int64, total, fps, running)
+	}
+	return s, err
+}
+
+// GetScenarioByID retrieves a scenario by its ID
+func (d *Database) GetScenarioByID(scenarioID string) (models.Scenario, error) {
+	s, err := scanScenario(d.DB.QueryRow(
+		"SELECT "+scenarioColumns+" FROM scenarios WHERE id = $1",
+		scenarioID,
+	))
+
 	if err != nil {
 		return models.Scenario{}, err
 	}
@@ -29,6 +65,75 @@ func (d *Database) GetScenarioByID(scenarioID string) (models.Scenario, error) {
 	return s, nil
 }
 
+// ListScenarios returns one page of scenarios matching the filter, ordered by the sort column and id.
+// Paging is keyset based: the next page starts strictly after filter.After
+func (d *Database) ListScenarios(ctx context.Context, filter models.ScenarioFilter) ([]models.Scenario, error) {
+	sortColumn := "created_at"
+	if filter.SortBy == models.SortByUpdatedAt {
+		sortColumn = "updated_at"
+	}
+	direction, cmp := "ASC", ">"
+	if filter.Desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		where = append(where, "status = ANY("+arg(pq.Array(statuses))+")")
+	}
+	if filter.CreatedFrom != nil {
+		where = append(where, "created_at >= "+arg(*filter.CreatedFrom))
+	}
+	if filter.CreatedTo != nil {
+		where = append(where, "created_at < "+arg(*filter.CreatedTo))
+	}
+	if filter.VideoSource != "" {
+		where = append(where, "video_source LIKE "+arg(likePrefix(filter.VideoSource)))
+	}
+	if filter.After != nil {
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)",
+			sortColumn, cmp, arg(filter.After.Time), arg(filter.After.ID)))
+	}
+
+	query := "SELECT " + scenarioColumns + " FROM scenarios"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", sortColumn, direction, direction, arg(filter.Limit))
+
+	rows, err := d.querier(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scenarios := make([]models.Scenario, 0, filter.Limit)
+	for rows.Next() {
+		s, err := scanScenario(rows)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	return scenarios, rows.Err()
+}
+
+// likePrefix экранирует спецсимволы LIKE и превращает строку в шаблон поиска по префиксу
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
 // CreateScenario creates a new scenario record
 func (d *Database) CreateScenario(ctx context.Context, scenario *models.Scenario) error {
 	now := time.Now()
@@ -36,12 +141,16 @@ func (d *Database) CreateScenario(ctx context.Context, scenario *models.Scenario
 	scenario.UpdatedAt = now
 
 	_, err := d.querier(ctx).Exec(
-		"INSERT INTO scenarios (id, status, video_source, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)",
+		`INSERT INTO scenarios (id, status, video_source, created_at, updated_at, ingest_source, extraction, video_metadata)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)`,
 		scenario.ID,
 		scenario.Status,
 		scenario.VideoSource,
 		scenario.CreatedAt,
 		scenario.UpdatedAt,
+		scenario.IngestSource,
+		jsonColumn{scenario.Extraction},
+		jsonColumn{scenario.Video},
 	)
 
 	return err
@@ -58,3 +167,81 @@ func (d *Database) UpdateScenarioStatus(ctx context.Context, scenarioID string,
 
 	return err
 }
+
+// NextResultVersion increments the scenario result version and returns the new value
+func (d *Database) NextResultVersion(ctx context.Context, scenarioID string) (int, error) {
+	var version int
+	err := d.querier(ctx).QueryRowContext(ctx,
+		"UPDATE scenarios SET result_version = result_version + 1 WHERE id = $1 RETURNING result_version",
+		scenarioID,
+	).Scan(&version)
+
+	return version, err
+}
+
+// GetAbandonedIngestingScenarios retrieves unfinished frame extraction jobs that no orchestrator instance
+// has renewed since renewedBefore, for example because the instance that owned them has restarted
+func (d *Database) GetAbandonedIngestingScenarios(ctx context.Context, renewedBefore time.Time) ([]models.Scenario, error) {
+	rows, err := d.querier(ctx).QueryContext(ctx,
+		`SELECT id, COALESCE(ingest_source, ''), extraction FROM scenarios
+		WHERE status = $1 AND COALESCE(ingest_renewed_at, created_at) < $2
+		ORDER BY created_at`,
+		models.StatusIngesting,
+		renewedBefore,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scenarios []models.Scenario
+	for rows.Next() {
+		var s models.Scenario
+		if err := rows.Scan(&s.ID, &s.IngestSource, jsonColumn{&s.Extraction}); err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	return scenarios, rows.Err()
+}
+
+// ClaimIngestingScenario takes over an abandoned frame extraction job. Returns false if another
+// orchestrator instance has renewed or claimed it since renewedBefore
+func (d *Database) ClaimIngestingScenario(ctx context.Context, scenarioID string, renewedBefore time.Time) (bool, error) {
+	result, err := d.querier(ctx).ExecContext(ctx,
+		`UPDATE scenarios SET ingest_renewed_at = NOW()
+		WHERE id = $1 AND status = $2 AND COALESCE(ingest_renewed_at, created_at) < $3`,
+		scenarioID,
+		models.StatusIngesting,
+		renewedBefore,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	return claimed > 0, err
+}
+
+// RenewIngestingScenarios marks frame extraction jobs as still owned by this orchestrator instance
+func (d *Database) RenewIngestingScenarios(ctx context.Context, scenarioIDs []string) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		"UPDATE scenarios SET ingest_renewed_at = NOW() WHERE id = ANY($1) AND status = $2",
+		pq.Array(scenarioIDs),
+		models.StatusIngesting,
+	)
+
+	return err
+}
+
+// SetIngestError stores the reason why frame extraction failed
+func (d *Database) SetIngestError(ctx context.Context, scenarioID string, cause string) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		"UPDATE scenarios SET ingest_error = $1 WHERE id = $2",
+		cause,
+		scenarioID,
+	)
+
+	return err
+}
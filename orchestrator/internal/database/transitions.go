@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+// LockScenarioStatus returns the scenario status and locks the row until the end of the transaction
+func (d *Database) LockScenarioStatus(ctx context.Context, scenarioID string) (models.ScenarioStatus, error) {
+	var status models.ScenarioStatus
+	err := d.querier(ctx).QueryRowContext(ctx,
+		"SELECT status FROM scenarios WHERE id = $1 FOR UPDATE",
+		scenarioID,
+	).Scan(&status)
+
+	return status, err
+}
+
+// AddTransition records a scenario status change in the history
+func (d *Database) AddTransition(ctx context.Context, t models.Transition) error {
+	_, err := d.querier(ctx).ExecContext(ctx,
+		`INSERT INTO scenario_transitions (scenario_id, from_status, to_status, event, actor, cause, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)`,
+		t.ScenarioID,
+		t.From,
+		t.To,
+		t.Event,
+		t.Actor,
+		t.Cause,
+		time.Now(),
+	)
+
+	return err
+}
+
+// GetTransitions returns the scenario status history, oldest first
+func (d *Database) GetTransitions(ctx context.Context, scenarioID string) ([]models.Transition, error) {
+	rows, err := d.querier(ctx).QueryContext(ctx,
+		`SELECT id, scenario_id, COALESCE(from_status, ''), to_status, event, actor, cause, created_at
+		FROM scenario_transitions WHERE scenario_id = $1 ORDER BY id`,
+		scenarioID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := make([]models.Transition, 0)
+	for rows.Next() {
+		var t models.Transition
+		if err := rows.Scan(&t.ID, &t.ScenarioID, &t.From, &t.To, &t.Event, &t.Actor, &t.Cause, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+
+	return transitions, rows.Err()
+}
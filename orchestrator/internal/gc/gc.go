@@ -0,0 +1,134 @@
+package gc
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/s3"
+)
+
+const gcInterval = time.Hour
+
+// Policy сроки хранения данных сценария после перехода в inactive, 0 - хранить всегда
+type Policy struct {
+	Frames      time.Duration
+	Predictions time.Duration
+	// Heartbeats срок хранения исходных heartbeats, после него секции сворачиваются в поминутные агрегаты
+	Heartbeats time.Duration
+	// DryRun только сообщает в лог, что было бы удалено
+	DryRun bool
+}
+
+// Collector в фоне удаляет данные сценариев по истечении сроков хранения
+type Collector struct {
+	db     *database.Database
+	s3     *s3.Client
+	policy Policy
+}
+
+func New(db *database.Database, s3Client *s3.Client, policy Policy) *Collector {
+	return &Collector{
+		db:     db,
+		s3:     s3Client,
+		policy: policy,
+	}
+}
+
+func (c *Collector) Start(ctx context.Context) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("GC stopped")
+			return
+		case <-ticker.C:
+			c.collect(ctx)
+		}
+	}
+}
+
+func (c *Collector) collect(ctx context.Context) {
+	if c.policy.Frames > 0 {
+		c.purge(ctx, "frames", s3.FramesBucket, database.FramesPurged, c.policy.Frames)
+	}
+	if c.policy.Predictions > 0 {
+		c.purge(ctx, "predictions", s3.PredictionsBucket, database.PredictionsPurged, c.policy.Predictions)
+	}
+	if c.policy.Heartbeats > 0 {
+		c.rollupHeartbeats(ctx)
+	}
+}
+
+// purge удаляет объекты <scenario>/ из бакета у сценариев, неактивных дольше retention
+func (c *Collector) purge(ctx context.Context, kind, bucket, purged string, retention time.Duration) {
+	ids, err := c.db.GetExpiredScenarios(ctx, purged, time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("GC: failed to get scenarios with expired %s: %v", kind, err)
+		return
+	}
+
+	total := 0
+	for _, id := range ids {
+		if c.policy.DryRun {
+			count, err := c.s3.CountPrefix(ctx, bucket, id+"/")
+			if err != nil {
+				log.Printf("GC: failed to count %s of scenario %s: %v", kind, id, err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("GC (dry run): would remove %d %s of scenario %s", count, kind, id)
+			}
+			total += count
+			continue
+		}
+
+		removed := 0
+		if err := c.s3.RemovePrefix(ctx, bucket, id+"/", func(n int) { removed += n }); err != nil {
+			log.Printf("GC: failed to remove %s of scenario %s: %v", kind, id, err)
+			continue
+		}
+		if err := c.db.MarkPurged(ctx, id, purged); err != nil {
+			log.Printf("GC: failed to mark %s of scenario %s as removed: %v", kind, id, err)
+			continue
+		}
+		total += removed
+	}
+
+	if c.policy.DryRun {
+		log.Printf("GC (dry run): would remove %d %s of %d scenarios older than %v", total, kind, len(ids), retention)
+	} else if len(ids) > 0 {
+		log.Printf("GC: removed %d %s of %d scenarios older than %v", total, kind, len(ids), retention)
+	}
+}
+
+// rollupHeartbeats сворачивает суточные секции heartbeats старше срока хранения в поминутные агрегаты
+func (c *Collector) rollupHeartbeats(ctx context.Context) {
+	partitions, err := c.db.GetHeartbeatPartitionsBefore(ctx, time.Now().Add(-c.policy.Heartbeats))
+	if err != nil {
+		log.Printf("GC: failed to get heartbeat partitions: %v", err)
+		return
+	}
+
+	for _, partition := range partitions {
+		if c.policy.DryRun {
+			count, err := c.db.CountHeartbeats(ctx, partition)
+			if err != nil {
+				log.Printf("GC: failed to count heartbeats in %s: %v", partition.Name, err)
+				continue
+			}
+			log.Printf("GC (dry run): would roll up %d heartbeats of %s and drop the partition", count, partition.Name)
+			continue
+		}
+
+		count, err := c.db.RollupHeartbeatPartition(ctx, partition)
+		if err != nil {
+			log.Printf("GC: failed to roll up heartbeats: %v", err)
+			continue
+		}
+		log.Printf("GC: rolled up %d heartbeats of %s", count, partition.Name)
+	}
+}
@@ -0,0 +1,142 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/s3"
+)
+
+// extractFrames извлекает кадры из видео и загружает их в S3
+func extractFrames(ctx context.Context, scenarioID, framesPath, videoPath string, opts models.ExtractionOptions) ([]string, error) {
+	started := time.Now()
+	// Извлекаем кадры с помощью ffmpeg
+	framePattern := filepath.Join(framesPath, "frame_%04d.jpg")
+	cmd := exec.CommandContext(ctx, "ffmpeg", ffmpegArgs(videoPath, framePattern, opts)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w, stderr: %s", err, stderr.String())
+	}
+
+	files, err := filepath.Glob(filepath.Join(framesPath, "frame_*.jpg"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list frame files: %w", err)
+	}
+	log.Printf("Ingest: extracted %d frames for scenario %s in %v", len(files), scenarioID, time.Since(started))
+
+	return files, nil
+}
+
+// ffmpegArgs собирает аргументы ffmpeg из настроек извлечения сценария
+func ffmpegArgs(videoPath, framePattern string, opts models.ExtractionOptions) []string {
+	var args []string
+	if opts.Start > 0 {
+		// -ss перед -i перематывает по ключевым кадрам, не декодируя начало видео
+		args = append(args, "-ss", formatFloat(opts.Start))
+	}
+	args = append(args, "-i", videoPath)
+	if opts.End > 0 {
+		args = append(args, "-t", formatFloat(opts.End-opts.Start))
+	}
+
+	filters := []string{"fps=" + formatFloat(opts.FPS)}
+	switch {
+	case opts.MaxWidth > 0 && opts.MaxHeight > 0:
+		filters = append(filters, fmt.Sprintf(
+			"scale=w='min(iw,%d)':h='min(ih,%d)':force_original_aspect_ratio=decrease", opts.MaxWidth, opts.MaxHeight))
+	case opts.MaxWidth > 0:
+		filters = append(filters, fmt.Sprintf("scale=w='min(iw,%d)':h=-2", opts.MaxWidth))
+	case opts.MaxHeight > 0:
+		filters = append(filters, fmt.Sprintf("scale=w=-2:h='min(ih,%d)'", opts.MaxHeight))
+	}
+
+	return append(args,
+		"-vf", strings.Join(filters, ","),
+		"-q:v", strconv.Itoa(opts.Quality), // Качество JPEG
+		framePattern,
+	)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (i *Ingester) saveFrames(ctx context.Context, scenarioID string, files []string) error {
+	frameCount := len(files)
+	if frameCount == 0 {
+		return fmt.Errorf("no frames extracted from video")
+	}
+
+	// Загружаем каждый кадр в S3
+	for _, framePath := range files {
+		frameFile, err := os.Open(framePath)
+		if err != nil {
+			return fmt.Errorf("failed to open frame file %s: %w", framePath, err)
+		}
+
+		frameInfo, err := frameFile.Stat()
+		if err != nil {
+			frameFile.Close()
+			return fmt.Errorf("failed to get frame file info: %w", err)
+		}
+
+		// Имя файла в S3: frames/{scenarioID}/frame_0001.jpg
+		fileName := filepath.Base(framePath)
+		objectName := fmt.Sprintf("%s/%s", scenarioID, fileName)
+
+		_, err = i.s3.UploadFileStream(ctx, s3.FramesBucket, objectName, frameFile, frameInfo.Size())
+		frameFile.Close()
+
+		if err != nil {
+			return fmt.Errorf("failed to upload frame %s to S3: %w", fileName, err)
+		}
+	}
+
+	return nil
+}
+
+// download скачивает видео из S3 или по HTTP во временный файл
+func (i *Ingester) download(ctx context.Context, u *url.URL, videoPath string) error {
+	if u.Scheme == "s3" {
+		return i.s3.DownloadFile(ctx, u.Host, strings.TrimPrefix(u.Path, "/"), videoPath)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	file, err := os.Create(videoPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
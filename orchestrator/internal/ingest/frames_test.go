@@ -0,0 +1,52 @@
+package ingest
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+func TestFFmpegArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts models.ExtractionOptions
+		want []string
+	}{
+		{
+			name: "defaults",
+			opts: models.DefaultExtractionOptions(),
+			want: []string{"-i", "in.mp4", "-vf", "fps=3", "-q:v", "2", "out/frame_%04d.jpg"},
+		},
+		{
+			name: "fragment",
+			opts: models.ExtractionOptions{FPS: 0.5, Quality: 5, Start: 1.5, End: 10},
+			want: []string{"-ss", "1.5", "-i", "in.mp4", "-t", "8.5", "-vf", "fps=0.5", "-q:v", "5", "out/frame_%04d.jpg"},
+		},
+		{
+			name: "bounding box",
+			opts: models.ExtractionOptions{FPS: 3, Quality: 2, MaxWidth: 640, MaxHeight: 480},
+			want: []string{"-i", "in.mp4",
+				"-vf", "fps=3,scale=w='min(iw,640)':h='min(ih,480)':force_original_aspect_ratio=decrease",
+				"-q:v", "2", "out/frame_%04d.jpg"},
+		},
+		{
+			name: "max width",
+			opts: models.ExtractionOptions{FPS: 3, Quality: 2, MaxWidth: 640},
+			want: []string{"-i", "in.mp4", "-vf", "fps=3,scale=w='min(iw,640)':h=-2", "-q:v", "2", "out/frame_%04d.jpg"},
+		},
+		{
+			name: "max height",
+			opts: models.ExtractionOptions{FPS: 3, Quality: 2, MaxHeight: 480},
+			want: []string{"-i", "in.mp4", "-vf", "fps=3,scale=w=-2:h='min(ih,480)'", "-q:v", "2", "out/frame_%04d.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ffmpegArgs("in.mp4", "out/frame_%04d.jpg", tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/s3"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
+)
+
+const (
+	queueSize = 100
+	// leaseTimeout задание, которое экземпляр оркестратора не продлевал дольше этого, считается брошенным
+	// и забирается другим экземпляром
+	leaseTimeout = time.Minute
+	// renewInterval как часто экземпляр продлевает свои задания
+	renewInterval = leaseTimeout / 4
+)
+
+// ErrQueueFull возвращается, если очередь заданий на извлечение кадров переполнена
+var ErrQueueFull = errors.New("ingest queue is full")
+
+// Job задание на извлечение кадров из видео сценария
+type Job struct {
+	ScenarioID string
+	// Source s3://bucket/key или http(s):// ссылка. Локальный путь остаётся только у заданий,
+	// принятых до сохранения загрузок в S3
+	Source string
+	// Options настройки извлечения кадров
+	Options models.ExtractionOptions
+}
+
+// Ingester в фоне извлекает кадры из видео и загружает их в S3.
+// Команда start попадает в outbox только после успешного извлечения
+type Ingester struct {
+	db      *database.Database
+	s3      *s3.Client
+	machine *statemachine.Machine
+	workers int
+	jobs    chan Job
+
+	// owned задания этого экземпляра в очереди и в обработке, их аренда продлевается
+	owned map[string]struct{}
+	mu    sync.Mutex
+}
+
+func New(db *database.Database, s3Client *s3.Client, machine *statemachine.Machine, workers int) *Ingester {
+	return &Ingester{
+		db:      db,
+		s3:      s3Client,
+		machine: machine,
+		workers: max(workers, 1),
+		jobs:    make(chan Job, queueSize),
+		owned:   make(map[string]struct{}),
+	}
+}
+
+// Submit ставит задание в очередь, не дожидаясь его выполнения.
+// Пока задание в очереди или в обработке, этот экземпляр продлевает его аренду
+func (i *Ingester) Submit(job Job) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	select {
+	case i.jobs <- job:
+		i.owned[job.ScenarioID] = struct{}{}
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Start запускает обработчиков, продлевает аренду заданий этого экземпляра
+// и забирает брошенные задания, например прерванные перезапуском
+func (i *Ingester) Start(ctx context.Context) {
+	for w := 0; w < i.workers; w++ {
+		go i.work(ctx)
+	}
+
+	renew := time.NewTicker(renewInterval)
+	defer renew.Stop()
+	resume := time.NewTicker(leaseTimeout)
+	defer resume.Stop()
+
+	i.resume(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-renew.C:
+			i.renew(ctx)
+		case <-resume.C:
+			i.resume(ctx)
+		}
+	}
+}
+
+func (i *Ingester) renew(ctx context.Context) {
+	i.mu.Lock()
+	ids := make([]string, 0, len(i.owned))
+	for id := range i.owned {
+		ids = append(ids, id)
+	}
+	i.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	if err := i.db.RenewIngestingScenarios(ctx, ids); err != nil {
+		log.Printf("Ingest: failed to renew jobs: %v", err)
+	}
+}
+
+func (i *Ingester) release(scenarioID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.owned, scenarioID)
+}
+
+func (i *Ingester) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-i.jobs:
+			i.process(ctx, job)
+		}
+	}
+}
+
+// resume забирает задания, аренду которых никто не продлевал дольше leaseTimeout.
+// Каждое задание забирает ровно один экземпляр оркестратора
+func (i *Ingester) resume(ctx context.Context) {
+	renewedBefore := time.Now().Add(-leaseTimeout)
+	scenarios, err := i.db.GetAbandonedIngestingScenarios(ctx, renewedBefore)
+	if err != nil {
+		log.Printf("Ingest: failed to get interrupted jobs: %v", err)
+		return
+	}
+
+	for _, scenario := range scenarios {
+		claimed, err := i.db.ClaimIngestingScenario(ctx, scenario.ID, renewedBefore)
+		if err != nil {
+			log.Printf("Ingest: failed to claim job for scenario %s: %v", scenario.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if isLocalFile(scenario.IngestSource) {
+			if _, err := os.Stat(scenario.IngestSource); err != nil {
+				// Задание принято до сохранения загрузок в S3 другим экземпляром или до перезапуска
+				i.fail(ctx, scenario.ID, errors.New("uploaded video was lost on restart"))
+				continue
+			}
+		}
+
+		job := Job{ScenarioID: scenario.ID, Source: scenario.IngestSource, Options: models.DefaultExtractionOptions()}
+		if scenario.Extraction != nil {
+			job.Options = *scenario.Extraction
+		}
+
+		log.Printf("Ingest: resuming interrupted job for scenario %s", scenario.ID)
+		if err := i.Submit(job); err != nil {
+			// Аренда истечёт, и задание заберут при следующей проверке
+			log.Printf("Ingest: failed to resume job for scenario %s: %v", scenario.ID, err)
+		}
+	}
+}
+
+func (i *Ingester) process(ctx context.Context, job Job) {
+	defer i.release(job.ScenarioID)
+	log.Printf("Ingest: started for scenario %s", job.ScenarioID)
+
+	err := i.ingest(ctx, job)
+	if ctx.Err() != nil {
+		// Экземпляр останавливается, загруженное видео нужно тому, кто заберёт задание
+		log.Printf("Ingest: scenario %s interrupted: %v", job.ScenarioID, err)
+		return
+	}
+	// Повторно кадры из загруженного видео не извлекаются ни после успеха, ни после ошибки
+	i.RemoveUpload(ctx, job.ScenarioID)
+	if err != nil {
+		log.Printf("Ingest: scenario %s failed: %v", job.ScenarioID, err)
+		i.fail(ctx, job.ScenarioID, err)
+		return
+	}
+
+	if _, err := i.machine.Fire(ctx, job.ScenarioID, statemachine.Trigger{
+		Event: statemachine.EventIngestDone,
+		Actor: statemachine.ActorIngest,
+		Cause: "frames extracted",
+	}); err != nil {
+		log.Printf("Ingest: failed to start scenario %s: %v", job.ScenarioID, err)
+		return
+	}
+
+	log.Printf("Ingest: finished for scenario %s", job.ScenarioID)
+}
+
+func (i *Ingester) ingest(ctx context.Context, job Job) error {
+	videoPath := job.Source
+	if isLocalFile(job.Source) {
+		defer os.Remove(videoPath)
+	} else {
+		u, err := url.Parse(job.Source)
+		if err != nil {
+			return err
+		}
+
+		videoPath = filepath.Join(os.TempDir(), fmt.Sprintf("%s.mp4", job.ScenarioID))
+		defer os.Remove(videoPath)
+		if err := i.download(ctx, u, videoPath); err != nil {
+			return fmt.Errorf("failed to download video: %w", err)
+		}
+	}
+
+	framesPath := filepath.Join(os.TempDir(), fmt.Sprintf("frames_%s", job.ScenarioID))
+	if err := os.MkdirAll(framesPath, 0755); err != nil {
+		return fmt.Errorf("failed to create frames directory: %w", err)
+	}
+	defer os.RemoveAll(framesPath)
+
+	frames, err := extractFrames(ctx, job.ScenarioID, framesPath, videoPath, job.Options)
+	if err != nil {
+		return fmt.Errorf("failed to extract frames: %w", err)
+	}
+
+	if err := i.saveFrames(ctx, job.ScenarioID, frames); err != nil {
+		return fmt.Errorf("failed to save frames: %w", err)
+	}
+
+	return nil
+}
+
+func (i *Ingester) fail(ctx context.Context, scenarioID string, cause error) {
+	if err := i.Fail(ctx, scenarioID, cause); err != nil {
+		log.Printf("Ingest: failed to mark scenario %s as failed: %v", scenarioID, err)
+	}
+}
+
+// Fail переводит сценарий в ingest_failed и сохраняет причину
+func (i *Ingester) Fail(ctx context.Context, scenarioID string, cause error) error {
+	return i.db.InTx(ctx, func(ctx context.Context) error {
+		if _, err := i.machine.Fire(ctx, scenarioID, statemachine.Trigger{
+			Event: statemachine.EventIngestFailed,
+			Actor: statemachine.ActorIngest,
+			Cause: cause.Error(),
+		}); err != nil {
+			return err
+		}
+		return i.db.SetIngestError(ctx, scenarioID, cause.Error())
+	})
+}
+
+// UploadSource источник ingest для видео, загруженного через API
+func UploadSource(scenarioID string) string {
+	return fmt.Sprintf("s3://%s/%s", s3.UploadsBucket, uploadKey(scenarioID))
+}
+
+func uploadKey(scenarioID string) string {
+	return scenarioID + "/video"
+}
+
+// SaveUpload сохраняет загруженное видео сценария в S3
+func (i *Ingester) SaveUpload(ctx context.Context, scenarioID, videoPath string) error {
+	file, err := os.Open(videoPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = i.s3.UploadFileStream(ctx, s3.UploadsBucket, uploadKey(scenarioID), file, info.Size())
+	return err
+}
+
+// RemoveUpload удаляет загруженное видео сценария, если оно есть
+func (i *Ingester) RemoveUpload(ctx context.Context, scenarioID string) {
+	if err := i.s3.RemovePrefix(ctx, s3.UploadsBucket, scenarioID+"/", func(int) {}); err != nil {
+		log.Printf("Ingest: failed to remove uploaded video of scenario %s: %v", scenarioID, err)
+	}
+}
+
+// isLocalFile отличает путь к загруженному файлу от ссылки на удалённое видео
+func isLocalFile(source string) bool {
+	return filepath.IsAbs(source)
+}
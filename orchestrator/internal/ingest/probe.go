@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+const probeTimeout = 30 * time.Second
+
+// Коды ошибок ProbeError
+const (
+	ProbeUnreadable        = "unreadable_video"
+	ProbeNoVideoStream     = "no_video_stream"
+	ProbeUnsupportedFormat = "unsupported_container"
+	ProbeUnsupportedCodec  = "unsupported_codec"
+	ProbeInvalidTimeRange  = "invalid_time_range"
+	probeUnavailable       = "probe_unavailable"
+)
+
+// ProbeError сообщает, почему видео не может быть принято
+type ProbeError struct {
+	Code    string
+	Message string
+}
+
+func (e *ProbeError) Error() string {
+	return e.Message
+}
+
+// Temporary ошибка не связана с самим видео, например ffprobe не запустился
+func (e *ProbeError) Temporary() bool {
+	return e.Code == probeUnavailable
+}
+
+// Поддерживаемые контейнеры (в терминах format_name ffprobe) и видеокодеки
+var (
+	supportedFormats = map[string]bool{
+		"mov": true, "mp4": true, "matroska": true, "webm": true,
+		"avi": true, "mpegts": true, "flv": true, "mpeg": true,
+	}
+	supportedCodecs = map[string]bool{
+		"h264": true, "hevc": true, "mpeg4": true, "mpeg2video": true,
+		"vp8": true, "vp9": true, "av1": true, "mjpeg": true,
+	}
+)
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		RFrameRate   string `json:"r_frame_rate"`
+		Duration     string `json:"duration"`
+		Disposition  struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe читает параметры видео через ffprobe и проверяет, что их можно обработать.
+// input - путь к файлу или http(s) ссылка
+func Probe(ctx context.Context, input string) (models.VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		input,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || ctx.Err() != nil {
+			return models.VideoMetadata{}, &ProbeError{Code: probeUnavailable, Message: fmt.Sprintf("ffprobe failed: %v", err)}
+		}
+		return models.VideoMetadata{}, &ProbeError{
+			Code:    ProbeUnreadable,
+			Message: fmt.Sprintf("file is not a readable video: %s", strings.TrimSpace(stderr.String())),
+		}
+	}
+
+	var out ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return models.VideoMetadata{}, &ProbeError{Code: probeUnavailable, Message: fmt.Sprintf("failed to parse ffprobe output: %v", err)}
+	}
+
+	return checkProbe(out)
+}
+
+func checkProbe(out ffprobeOutput) (models.VideoMetadata, error) {
+	meta := models.VideoMetadata{Container: out.Format.FormatName}
+
+	supported := false
+	for _, name := range strings.Split(out.Format.FormatName, ",") {
+		supported = supported || supportedFormats[name]
+	}
+	if !supported {
+		return meta, &ProbeError{Code: ProbeUnsupportedFormat, Message: fmt.Sprintf("container %q is not supported", out.Format.FormatName)}
+	}
+
+	for _, stream := range out.Streams {
+		// Обложка mp4 тоже видеопоток из одной картинки
+		if stream.CodecType != "video" || stream.Disposition.AttachedPic == 1 {
+			continue
+		}
+
+		meta.Codec = stream.CodecName
+		meta.Width = stream.Width
+		meta.Height = stream.Height
+		meta.FrameRate = parseRate(stream.AvgFrameRate)
+		if meta.FrameRate == 0 {
+			meta.FrameRate = parseRate(stream.RFrameRate)
+		}
+		meta.Duration, _ = strconv.ParseFloat(out.Format.Duration, 64)
+		if meta.Duration == 0 {
+			meta.Duration, _ = strconv.ParseFloat(stream.Duration, 64)
+		}
+		break
+	}
+
+	switch {
+	case meta.Codec == "":
+		return meta, &ProbeError{Code: ProbeNoVideoStream, Message: "file has no video stream"}
+	case !supportedCodecs[meta.Codec]:
+		return meta, &ProbeError{Code: ProbeUnsupportedCodec, Message: fmt.Sprintf("codec %q is not supported", meta.Codec)}
+	case meta.Width == 0 || meta.Height == 0 || meta.Duration <= 0:
+		return meta, &ProbeError{Code: ProbeUnreadable, Message: "video has no resolution or duration"}
+	}
+
+	return meta, nil
+}
+
+// CheckTimeRange проверяет, что фрагмент извлечения попадает в видео
+func CheckTimeRange(meta models.VideoMetadata, opts models.ExtractionOptions) error {
+	if opts.Start >= meta.Duration {
+		return &ProbeError{
+			Code:    ProbeInvalidTimeRange,
+			Message: fmt.Sprintf("start %gs is beyond video duration %gs", opts.Start, meta.Duration),
+		}
+	}
+	return nil
+}
+
+// parseRate разбирает частоту кадров ffprobe вида "30000/1001"
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		v, _ := strconv.ParseFloat(rate, 64)
+		return v
+	}
+
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
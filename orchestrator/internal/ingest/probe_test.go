@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+func TestCheckProbe(t *testing.T) {
+	tests := []struct {
+		name string
+		// output вывод ffprobe -print_format json
+		output string
+		want   models.VideoMetadata
+		code   string
+	}{
+		{
+			name: "mp4",
+			output: `{"streams": [
+				{"codec_type": "audio", "codec_name": "aac"},
+				{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30000/1001"}
+			], "format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.5"}}`,
+			want: models.VideoMetadata{Container: "mov,mp4,m4a,3gp,3g2,mj2", Codec: "h264", Width: 1920, Height: 1080, FrameRate: 30000.0 / 1001, Duration: 12.5},
+		},
+		{
+			name: "cover art and stream duration",
+			output: `{"streams": [
+				{"codec_type": "video", "codec_name": "png", "width": 300, "height": 300, "disposition": {"attached_pic": 1}},
+				{"codec_type": "video", "codec_name": "vp9", "width": 640, "height": 360, "avg_frame_rate": "0/0", "r_frame_rate": "25/1", "duration": "3"}
+			], "format": {"format_name": "matroska,webm"}}`,
+			want: models.VideoMetadata{Container: "matroska,webm", Codec: "vp9", Width: 640, Height: 360, FrameRate: 25, Duration: 3},
+		},
+		{
+			name:   "unsupported container",
+			output: `{"streams": [{"codec_type": "video", "codec_name": "gif"}], "format": {"format_name": "gif"}}`,
+			code:   ProbeUnsupportedFormat,
+		},
+		{
+			name:   "audio only",
+			output: `{"streams": [{"codec_type": "audio", "codec_name": "mp3"}], "format": {"format_name": "mp4", "duration": "60"}}`,
+			code:   ProbeNoVideoStream,
+		},
+		{
+			name:   "unsupported codec",
+			output: `{"streams": [{"codec_type": "video", "codec_name": "prores", "width": 1, "height": 1}], "format": {"format_name": "mov", "duration": "1"}}`,
+			code:   ProbeUnsupportedCodec,
+		},
+		{
+			name:   "no duration",
+			output: `{"streams": [{"codec_type": "video", "codec_name": "h264", "width": 1, "height": 1}], "format": {"format_name": "mpegts"}}`,
+			code:   ProbeUnreadable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out ffprobeOutput
+			if err := json.Unmarshal([]byte(tt.output), &out); err != nil {
+				t.Fatal(err)
+			}
+
+			meta, err := checkProbe(out)
+			if tt.code != "" {
+				var probeErr *ProbeError
+				if !errors.As(err, &probeErr) || probeErr.Code != tt.code {
+					t.Fatalf("got error %v, want code %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if meta != tt.want {
+				t.Errorf("got %+v, want %+v", meta, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]float64{
+		"30000/1001": 30000.0 / 1001,
+		"25/1":       25,
+		"0/0":        0,
+		"24":         24,
+		"":           0,
+		"a/b":        0,
+	}
+
+	for rate, want := range tests {
+		if got := parseRate(rate); got != want {
+			t.Errorf("parseRate(%q) = %v, want %v", rate, got, want)
+		}
+	}
+}
+
+func TestCheckTimeRange(t *testing.T) {
+	meta := models.VideoMetadata{Duration: 10}
+	if err := CheckTimeRange(meta, models.ExtractionOptions{Start: 9.5}); err != nil {
+		t.Errorf("start inside video: %v", err)
+	}
+	var probeErr *ProbeError
+	if err := CheckTimeRange(meta, models.ExtractionOptions{Start: 10}); !errors.As(err, &probeErr) || probeErr.Code != ProbeInvalidTimeRange {
+		t.Errorf("start at the end: got %v, want %s", err, ProbeInvalidTimeRange)
+	}
+}
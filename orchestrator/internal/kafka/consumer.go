@@ -2,18 +2,28 @@ package kafka
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
 	"github.com/IBM/sarama"
 	"github.com/goccy/go-json"
 )
 
 type db interface {
 	GetScenarioByID(scenarioID string) (models.Scenario, error)
-	WriteHeartbeat(models.Heartbeat) error
-	UpdateScenarioStatus(ctx context.Context, scenarioID string, status models.ScenarioStatus) error
+	WriteHeartbeat(ctx context.Context, heartbeat models.Heartbeat) error
+	RecordFrameFailures(ctx context.Context, scenarioID string, failures []models.FrameFailure) error
+	ClearFrameFailures(ctx context.Context, scenarioID string, frames []int64) error
+	MarkRunnerDeleted(ctx context.Context, scenarioID string) error
+}
+
+type machine interface {
+	Fire(ctx context.Context, scenarioID string, trigger statemachine.Trigger) (models.ScenarioStatus, error)
 }
 
 // Consumer оборачивает Sarama ConsumerGroup
@@ -44,10 +54,11 @@ func NewConsumer(brokers []string, groupID, topic string) (*Consumer, error) {
 	}, nil
 }
 
-func (c *Consumer) StartListening(ctx context.Context, db db) {
+func (c *Consumer) StartListening(ctx context.Context, db db, machine machine) {
 	handler := &consumerGroupHandler{
-		db:     db,
-		closed: c.closed,
+		db:      db,
+		machine: machine,
+		closed:  c.closed,
 	}
 
 	go func() {
@@ -95,8 +106,9 @@ func (c *Consumer) Messages() <-chan []byte {
 }
 
 type consumerGroupHandler struct {
-	db     db
-	closed <-chan struct{}
+	db      db
+	machine machine
+	closed  <-chan struct{}
 }
 
 func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
@@ -117,36 +129,71 @@ func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cl
 
 			var heartbeat models.Heartbeat
 			if err := json.Unmarshal(msg.Value, &heartbeat); err != nil {
+				// Например, heartbeat более новой версии раннера: повторная доставка не поможет
 				log.Printf("Invalid message format: %v", err)
+				sess.MarkMessage(msg, "")
+				continue
 			}
 
 			ctx := context.Background()
 
 			scenario, err := h.db.GetScenarioByID(heartbeat.ScenarioID)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Запоздавший heartbeat уже удалённого сценария
+				log.Printf("Heartbeat %s for deleted scenario %s skipped", heartbeat.Action, heartbeat.ScenarioID)
+				sess.MarkMessage(msg, "")
+				continue
+			}
 			if err != nil {
 				log.Printf("Error getting scenario: %v", err)
 				return err
 			}
 
-			if heartbeat.Action == models.CommandStart && scenario.Status == models.StatusInStartupProcessing {
-				log.Printf("Starting heartbeat for scenario %v", scenario.ID)
-				if err := h.db.UpdateScenarioStatus(ctx, heartbeat.ScenarioID, models.StatusActive); err != nil {
-					log.Printf("Failed to update scenario status in DB: %v", err)
+			if heartbeat.Action == models.CommandDelete {
+				// Раннеры остановили сценарий и удалили свои записи, данные можно очищать
+				if err := h.db.MarkRunnerDeleted(ctx, heartbeat.ScenarioID); err != nil {
+					log.Printf("Failed to record runner deletion: %v", err)
 					continue
 				}
-			} else if heartbeat.Action == models.CommandStop &&
-				(scenario.Status == models.StatusInShutdownProcessing || scenario.Status == models.StatusActive) {
-				if err := h.db.UpdateScenarioStatus(ctx, heartbeat.ScenarioID, models.StatusInactive); err != nil {
+				sess.MarkMessage(msg, "")
+				continue
+			}
+
+			// Heartbeat работающего сценария приходит регулярно, статус меняет только первый
+			event := statemachine.EventRunnerStarted
+			switch heartbeat.Action {
+			case models.CommandStop:
+				event = statemachine.EventRunnerStopped
+			case models.CommandPause:
+				event = statemachine.EventRunnerPaused
+			}
+			if statemachine.Can(scenario.Status, event) {
+				log.Printf("Heartbeat %s for scenario %v", heartbeat.Action, scenario.ID)
+				if _, err := h.machine.Fire(ctx, heartbeat.ScenarioID, statemachine.Trigger{
+					Event: event,
+					Actor: statemachine.ActorRunner,
+					Cause: fmt.Sprintf("heartbeat %s at frame %d", heartbeat.Action, heartbeat.Frame),
+				}); err != nil {
 					log.Printf("Failed to update scenario status in DB: %v", err)
 					continue
 				}
 			}
 
-			if err := h.db.WriteHeartbeat(heartbeat); err != nil {
+			if err := h.db.WriteHeartbeat(ctx, heartbeat); err != nil {
 				log.Printf("Failed to write message to DB: %v", err)
 				continue
 			}
 
+			if err := h.db.RecordFrameFailures(ctx, heartbeat.ScenarioID, heartbeat.FailedFrames); err != nil {
+				log.Printf("Failed to record failed frames: %v", err)
+				continue
+			}
+
+			if err := h.db.ClearFrameFailures(ctx, heartbeat.ScenarioID, heartbeat.RecoveredFrames); err != nil {
+				log.Printf("Failed to clear recovered frames: %v", err)
+				continue
+			}
+
 			// Подтверждаем обработку сообщения
 			sess.MarkMessage(msg, "")
 		case <-sess.Context().Done():
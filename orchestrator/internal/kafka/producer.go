@@ -13,11 +13,15 @@ type Producer struct {
 	Topic    string
 }
 
-// NewKafkaProducer создаёт продюсер с настройками
+// NewKafkaProducer создаёт продюсер с настройками. Продюсер идемпотентный: повторы внутри
+// sarama после сетевых ошибок не дублируют и не переставляют сообщения в партиции
 func NewKafkaProducer(brokers []string, topic string) (*Producer, error) {
 	config := sarama.NewConfig()
+	config.Version = sarama.V2_6_0_0
 	config.Producer.Return.Successes = true
 	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Idempotent = true
+	config.Net.MaxOpenRequests = 1
 
 	producer, err := sarama.NewSyncProducer(brokers, config)
 	if err != nil {
@@ -30,9 +34,10 @@ func NewKafkaProducer(brokers []string, topic string) (*Producer, error) {
 	}, nil
 }
 
-// SendOutboxMessageToKafka отправляет одно сообщение в Kafka
+// SendOutboxMessageToKafka отправляет одно сообщение в Kafka. Если оркестратор упадёт до того,
+// как отметит сообщение отправленным, команда уйдёт повторно с тем же ID
 func (kp *Producer) SendOutboxMessageToKafka(msg *models.OutboxMessage) error {
-	payload, err := json.Marshal(msg)
+	payload, err := json.Marshal(msg.Command())
 	if err != nil {
 		return err
 	}
@@ -41,6 +46,9 @@ func (kp *Producer) SendOutboxMessageToKafka(msg *models.OutboxMessage) error {
 		Topic: kp.Topic,
 		Key:   sarama.StringEncoder(msg.ScenarioID),
 		Value: sarama.ByteEncoder(payload),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("command_id"), Value: []byte(msg.ID)},
+		},
 	}
 
 	partition, offset, err := kp.Producer.SendMessage(kafkaMsg)
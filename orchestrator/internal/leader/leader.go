@@ -0,0 +1,93 @@
+package leader
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
+)
+
+const (
+	lockName = "orchestrator-leader"
+	// checkInterval как часто кандидат пытается стать лидером, а лидер проверяет блокировку
+	checkInterval = 5 * time.Second
+)
+
+// isLeader 1, если этот экземпляр сейчас лидер, доступно в /debug/vars
+var isLeader = expvar.NewInt("leader")
+
+// Elector выбирает среди экземпляров оркестратора одного лидера с помощью advisory блокировки Postgres.
+// Если лидер упал, его соединение закрывается, блокировка снимается и лидером становится другой экземпляр
+type Elector struct {
+	db *database.Database
+}
+
+func New(db *database.Database) *Elector {
+	return &Elector{db: db}
+}
+
+// Run запускает workers, пока экземпляр остаётся лидером. При потере блокировки контекст
+// workers отменяется, и новая попытка стать лидером делается только после их остановки,
+// чтобы два экземпляра не работали одновременно. Возвращается после отмены ctx
+func (e *Elector) Run(ctx context.Context, workers ...func(ctx context.Context)) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := e.db.TryAdvisoryLock(ctx, lockName)
+		if err != nil {
+			log.Printf("Leader: failed to take lock: %v", err)
+		}
+		if lock != nil {
+			e.lead(ctx, lock, ticker, workers)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) lead(ctx context.Context, lock *database.AdvisoryLock, ticker *time.Ticker, workers []func(ctx context.Context)) {
+	log.Println("Leader: this instance is the leader, starting background workers")
+	isLeader.Set(1)
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker(workerCtx)
+		}()
+	}
+
+	e.hold(ctx, lock, ticker)
+	cancel()
+
+	wg.Wait()
+	lock.Release()
+	isLeader.Set(0)
+	log.Println("Leader: background workers stopped")
+}
+
+// hold возвращается, когда блокировка потеряна или ctx отменён
+func (e *Elector) hold(ctx context.Context, lock *database.AdvisoryLock, ticker *time.Ticker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := lock.Check(ctx); err != nil {
+				log.Printf("Leader: lost lock: %v", err)
+				return
+			}
+		}
+	}
+}
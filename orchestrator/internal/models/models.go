@@ -2,7 +2,11 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/contract"
 )
 
 // ScenarioStatus Константы статусов
@@ -15,29 +19,201 @@ const (
 	StatusInitShutdown         ScenarioStatus = "init_shutdown"
 	StatusInShutdownProcessing ScenarioStatus = "in_shutdown_processing"
 	StatusInactive             ScenarioStatus = "inactive"
+	StatusIngesting            ScenarioStatus = "ingesting"
+	StatusIngestFailed         ScenarioStatus = "ingest_failed"
+	StatusPausing              ScenarioStatus = "pausing"
+	StatusPaused               ScenarioStatus = "paused"
+	StatusDeleting             ScenarioStatus = "deleting"
+	StatusFailed               ScenarioStatus = "failed"
 )
 
+// Statuses все известные статусы сценария
+var Statuses = []ScenarioStatus{
+	StatusInitStartup,
+	StatusInStartupProcessing,
+	StatusActive,
+	StatusInitShutdown,
+	StatusInShutdownProcessing,
+	StatusInactive,
+	StatusIngesting,
+	StatusIngestFailed,
+	StatusPausing,
+	StatusPaused,
+	StatusDeleting,
+	StatusFailed,
+}
+
 // Scenario Структура для сценариев
 type Scenario struct {
-	ID          string         `json:"id"`
-	Status      ScenarioStatus `json:"status"`
-	VideoSource string         `json:"video_source"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+	ID           string             `json:"id"`
+	Status       ScenarioStatus     `json:"status"`
+	VideoSource  string             `json:"video_source"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+	IngestSource string             `json:"-"`
+	IngestError  string             `json:"ingest_error,omitempty"`
+	Extraction   *ExtractionOptions `json:"extraction,omitempty"`
+	Video        *VideoMetadata     `json:"video_metadata,omitempty"`
+	FailedFrames []FrameFailure     `json:"failed_frames,omitempty"`
+	// ResultVersion версия результатов последнего прогона: 0 - исходная обработка, далее - replay
+	ResultVersion int `json:"result_version"`
+	// Deletion ход удаления, есть только у сценария в статусе deleting
+	Deletion *DeletionProgress `json:"deletion,omitempty"`
+	// FramesPurgedAt и PredictionsPurgedAt время удаления данных по сроку хранения
+	FramesPurgedAt      *time.Time `json:"frames_purged_at,omitempty"`
+	PredictionsPurgedAt *time.Time `json:"predictions_purged_at,omitempty"`
+	// LastHeartbeatAt и LastFrame время и кадр последнего heartbeat раннера
+	LastHeartbeatAt *time.Time `json:"last_heartbeat_at,omitempty"`
+	LastFrame       *int64     `json:"last_frame,omitempty"`
+	// Progress ход обработки по последнему heartbeat с прогрессом
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// Progress ход обработки сценария
+type Progress struct {
+	ProcessedFrames int64    `json:"processed_frames"`
+	TotalFrames     int64    `json:"total_frames,omitempty"` // 0 для живого потока
+	Percent         *float64 `json:"percent,omitempty"`
+	FPS             float64  `json:"fps"`                   // скорость обработки, кадров в секунду
+	ETASeconds      *float64 `json:"eta_seconds,omitempty"` // только для записанного видео, пока сценарий обрабатывается
+}
+
+// NewProgress считает процент и оставшееся время по данным последнего heartbeat.
+// Скорость остановленного сценария не имеет смысла и не показывается
+func NewProgress(processed, total int64, fps float64, running bool) *Progress {
+	p := &Progress{ProcessedFrames: processed, TotalFrames: total}
+	if running {
+		p.FPS = fps
+	}
+
+	if total > 0 {
+		percent := min(float64(processed)/float64(total)*100, 100)
+		p.Percent = &percent
+
+		if p.FPS > 0 {
+			eta := float64(max(total-processed, 0)) / p.FPS
+			p.ETASeconds = &eta
+		}
+	}
+
+	return p
 }
 
-// Prediction Структура для предсказаний
-type Prediction struct {
-	ID         string          `json:"id"`
-	ScenarioID string          `json:"scenario_id"`
-	Timestamp  time.Time       `json:"timestamp"`
-	Data       json.RawMessage `json:"data"`
+// DeletionProgress ход фонового удаления данных сценария
+type DeletionProgress struct {
+	RequestedAt        time.Time `json:"requested_at"`
+	RunnerDone         bool      `json:"runner_done"` // раннеры остановили сценарий и удалили свои записи
+	FramesDeleted      int       `json:"frames_deleted"`
+	PredictionsDeleted int       `json:"predictions_deleted"`
+	Error              string    `json:"error,omitempty"` // последняя ошибка очистки, она будет повторена
+}
+
+// FramePrediction результаты детекции одного кадра
+type FramePrediction struct {
+	Frame      int         `json:"frame"`
+	Detections []Detection `json:"detections"`
+}
+
+// PredictionFilter страница и фильтры результатов сценария
+type PredictionFilter struct {
+	FromFrame int
+	ToFrame   int // включительно, -1 - до последнего кадра
+	Limit     int // максимум кадров на странице
+	Classes   []string
+	MinScore  float64
+	Version   int // версия результатов
 }
 
 // ScenarioCreate Структура для создания сценария
 type ScenarioCreate struct {
-	VideoSource string          `json:"video_source"`
-	Config      json.RawMessage `json:"config,omitempty"`
+	VideoSource string          `json:"video_source"`          // s3://, http(s):// или rtsp:// ссылка
+	SourceType  string          `json:"source_type,omitempty"` // file или stream, по умолчанию определяется по схеме
+	Config      json.RawMessage `json:"config,omitempty"`      // ExtractionOptions для видеофайлов
+}
+
+// ExtractionOptions настройки извлечения кадров из видео
+type ExtractionOptions struct {
+	FPS       float64 `json:"fps"`                  // кадров в секунду
+	Quality   int     `json:"quality"`              // качество JPEG в шкале ffmpeg -q:v: 2 (лучшее) - 31
+	MaxWidth  int     `json:"max_width,omitempty"`  // кадры шире уменьшаются с сохранением пропорций
+	MaxHeight int     `json:"max_height,omitempty"` // кадры выше уменьшаются с сохранением пропорций
+	Start     float64 `json:"start,omitempty"`      // начало фрагмента, секунды от начала видео
+	End       float64 `json:"end,omitempty"`        // конец фрагмента, 0 - до конца видео
+}
+
+// DefaultExtractionOptions настройки, с которыми кадры извлекались до их появления в запросе
+func DefaultExtractionOptions() ExtractionOptions {
+	return ExtractionOptions{FPS: 3, Quality: 2}
+}
+
+// Validate проверяет, что настройки можно передать в ffmpeg
+func (o ExtractionOptions) Validate() error {
+	switch {
+	// Сравнения с NaN всегда ложны, поэтому без явной проверки он прошёл бы все условия ниже
+	case !finite(o.FPS) || !finite(o.Start) || !finite(o.End):
+		return errors.New("fps, start and end must be finite numbers")
+	case o.FPS <= 0 || o.FPS > 60:
+		return errors.New("fps must be in range (0, 60]")
+	case o.Quality < 2 || o.Quality > 31:
+		return errors.New("quality must be in range [2, 31]")
+	case o.MaxWidth < 0 || o.MaxHeight < 0:
+		return errors.New("max_width and max_height must not be negative")
+	case o.Start < 0 || o.End < 0:
+		return errors.New("start and end must not be negative")
+	case o.End != 0 && o.End <= o.Start:
+		return errors.New("end must be greater than start")
+	}
+	return nil
+}
+
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// Сортировка списка сценариев
+const (
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+)
+
+// ScenarioFilter фильтры и страница списка сценариев
+type ScenarioFilter struct {
+	Statuses    []ScenarioStatus
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	VideoSource string // префикс video_source
+	SortBy      string
+	Desc        bool
+	Limit       int
+	After       *ScenarioCursor
+}
+
+// ScenarioCursor позиция последнего сценария предыдущей страницы
+type ScenarioCursor struct {
+	Time time.Time `json:"t"` // значение колонки сортировки
+	ID   string    `json:"id"`
+}
+
+// VideoMetadata параметры видео, полученные ffprobe при создании сценария
+type VideoMetadata struct {
+	Container string  `json:"container"`
+	Codec     string  `json:"codec"`
+	Duration  float64 `json:"duration"` // секунды
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	FrameRate float64 `json:"frame_rate"`
+}
+
+// Transition запись истории смены статуса сценария
+type Transition struct {
+	ID         int64          `json:"id"`
+	ScenarioID string         `json:"scenario_id"`
+	From       ScenarioStatus `json:"from,omitempty"` // пусто для создания сценария
+	To         ScenarioStatus `json:"to"`
+	Event      string         `json:"event"`
+	Actor      string         `json:"actor"`
+	Cause      string         `json:"cause"`
+	CreatedAt  time.Time      `json:"created_at"`
 }
 
 // StatusUpdate Структура для обновления статуса
@@ -53,18 +229,50 @@ type OutboxMessage struct {
 	CreatedAt   time.Time     `json:"created_at"`
 	ProcessedAt *time.Time    `json:"processed_at"`
 	VideoSource string        `json:"video_source"`
+	// Attempts число неудачных попыток отправки, следующая не раньше NextAttemptAt
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	// DeadAt время, когда команда исчерпала попытки и перестала отправляться
+	DeadAt *time.Time `json:"dead_at,omitempty"`
+	CommandPayload
 }
 
-type CommandAction string
+// Command возвращает команду, которую сообщение outbox отправляет раннерам. ID команды совпадает с ID
+// строки outbox и не меняется при повторной отправке, по нему раннеры пропускают уже обработанные команды
+func (m *OutboxMessage) Command() contract.Command {
+	return contract.Command{
+		ID:          m.ID,
+		ScenarioID:  m.ScenarioID,
+		Action:      m.Action,
+		VideoSource: m.VideoSource,
+		CreatedAt:   m.CreatedAt,
+		Frames:      m.Frames,
+		Replay:      m.Replay,
+	}
+}
 
-const (
-	CommandStart CommandAction = "start"
-	CommandStop  CommandAction = "stop"
+// CommandPayload дополнительные параметры команды раннеру, хранятся в outbox.payload
+type CommandPayload struct {
+	Frames []int64      `json:"frames,omitempty"` // кадры для CommandReprocessFailed
+	Replay *ReplayRange `json:"replay,omitempty"` // диапазон для CommandReplay
+}
+
+// Сообщения Kafka описаны в общем контракте оркестратора и раннеров
+type (
+	CommandAction = contract.CommandAction
+	ReplayRange   = contract.ReplayRange
+	Heartbeat     = contract.Heartbeat
+	FrameFailure  = contract.FrameFailure
+	Detection     = contract.Detection
 )
 
-type Heartbeat struct {
-	ScenarioID string        `json:"ScenarioID"`
-	Action     CommandAction `json:"Action"`
-	Frame      int64         `json:"Frame"`
-	TimeStamp  time.Time     `json:"TimeStamp"`
-}
+const (
+	CommandStart           = contract.CommandStart
+	CommandStop            = contract.CommandStop
+	CommandReprocessFailed = contract.CommandReprocessFailed
+	CommandPause           = contract.CommandPause
+	CommandResume          = contract.CommandResume
+	CommandReplay          = contract.CommandReplay
+	CommandDelete          = contract.CommandDelete
+)
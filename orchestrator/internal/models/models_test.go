@@ -0,0 +1,45 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExtractionOptionsValidate(t *testing.T) {
+	valid := DefaultExtractionOptions()
+	with := func(change func(o *ExtractionOptions)) ExtractionOptions {
+		o := valid
+		change(&o)
+		return o
+	}
+
+	tests := []struct {
+		name  string
+		opts  ExtractionOptions
+		valid bool
+	}{
+		{name: "defaults", opts: valid, valid: true},
+		{name: "fragment", opts: with(func(o *ExtractionOptions) { o.Start, o.End = 5, 10 }), valid: true},
+		{name: "open end", opts: with(func(o *ExtractionOptions) { o.Start = 5 }), valid: true},
+		{name: "max fps", opts: with(func(o *ExtractionOptions) { o.FPS = 60 }), valid: true},
+		{name: "zero fps", opts: with(func(o *ExtractionOptions) { o.FPS = 0 }), valid: false},
+		{name: "fps too high", opts: with(func(o *ExtractionOptions) { o.FPS = 61 }), valid: false},
+		{name: "NaN fps", opts: with(func(o *ExtractionOptions) { o.FPS = math.NaN() }), valid: false},
+		{name: "infinite end", opts: with(func(o *ExtractionOptions) { o.End = math.Inf(1) }), valid: false},
+		{name: "quality too low", opts: with(func(o *ExtractionOptions) { o.Quality = 1 }), valid: false},
+		{name: "quality too high", opts: with(func(o *ExtractionOptions) { o.Quality = 32 }), valid: false},
+		{name: "negative width", opts: with(func(o *ExtractionOptions) { o.MaxWidth = -1 }), valid: false},
+		{name: "negative start", opts: with(func(o *ExtractionOptions) { o.Start = -1 }), valid: false},
+		{name: "end before start", opts: with(func(o *ExtractionOptions) { o.Start, o.End = 10, 5 }), valid: false},
+		{name: "empty fragment", opts: with(func(o *ExtractionOptions) { o.Start, o.End = 5, 5 }), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -2,69 +2,206 @@ package outbox
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/kafka"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
 )
 
-func StartOutboxDispatcher(ctx context.Context, db *database.Database, brokers []string, topic string, interval time.Duration) {
+const (
+	// outboxBatch сколько команд отправляется за один проход, каждая в своей транзакции
+	outboxBatch = 100
+	// Задержка перед повторной отправкой удваивается с каждой неудачной попыткой, но не больше maxBackoff
+	baseBackoff = time.Second
+	maxBackoff  = 5 * time.Minute
+)
+
+// Метрики диспетчера, доступны в /debug/vars
+var (
+	dispatched     = expvar.NewInt("outbox_dispatched")
+	dispatchFailed = expvar.NewInt("outbox_dispatch_failed")
+	deadCommands   = expvar.NewInt("outbox_dead")
+	// dispatchLatency время от записи последней отправленной команды в outbox до её отправки в Kafka
+	dispatchLatency = expvar.NewFloat("outbox_dispatch_latency_seconds")
+	// dispatchLatencyTotal сумма задержек, средняя задержка - outbox_dispatch_latency_seconds_total / outbox_dispatched
+	dispatchLatencyTotal = expvar.NewFloat("outbox_dispatch_latency_seconds_total")
+)
+
+// StartOutboxDispatcher отправляет команды outbox в Kafka. Диспетчер просыпается по NOTIFY
+// из AddCommandToOutbox и отправляет команды по одной, пока очередь не опустеет.
+// Опрос раз в interval нужен только на случай потерянных уведомлений.
+// Неотправленная команда повторяется с экспоненциальной задержкой, после maxAttempts попыток
+// она становится мёртвой, а сценарий переходит в failed. 0 - повторять без ограничения
+func StartOutboxDispatcher(ctx context.Context, db *database.Database, machine *statemachine.Machine, brokers []string, topic string, interval time.Duration, maxAttempts int) {
 	producer, err := kafka.NewKafkaProducer(brokers, topic)
 	if err != nil {
 		log.Fatalf("Failed to create Kafka producer: %v", err)
 	}
 	defer producer.Producer.Close()
 
+	wake, err := db.ListenOutbox(ctx)
+	if err != nil {
+		// Без уведомлений команды всё равно будут отправлены по таймеру
+		log.Printf("Failed to listen for outbox notifications, polling every %v: %v", interval, err)
+	}
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
+		for {
+			handled, err := dispatchBatch(ctx, db, machine, producer, maxAttempts)
+			if err != nil {
+				log.Printf("Error dispatching outbox messages: %v", err)
+				break
+			}
+			if handled < outboxBatch {
+				break
+			}
+		}
+
+		// Просыпаемся к ближайшей повторной попытке, если она раньше очередного опроса
+		var retry <-chan time.Time
+		if delay, ok, err := db.NextOutboxAttemptIn(ctx); err != nil {
+			log.Printf("Failed to get next outbox retry time: %v", err)
+		} else if ok && delay < interval {
+			retry = time.After(delay)
+		}
+
 		select {
 		case <-ctx.Done():
 			log.Println("Outbox dispatcher stopped")
 			return
+		case <-wake:
 		case <-ticker.C:
-			// Читаем непрочитанные сообщения
-			messages, err := db.GetPendingOutboxMessages(1)
-			if err != nil {
-				log.Printf("Error fetching outbox messages: %v", err)
-				continue
-			}
+		case <-retry:
+		}
+	}
+}
+
+// dispatchBatch отправляет до outboxBatch команд и возвращает число обработанных.
+// Команды выбираются по одной, а не пачкой через SKIP LOCKED LIMIT n, намеренно:
+//   - строки пачки оставались бы заблокированными до конца её отправки, и stop, pause или delete
+//     не смогли бы отменить ещё не отправленную команду запуска из пачки (cancelPending её пропускает);
+//   - отметить отправку в отдельной транзакции, пока строки пачки заблокированы транзакцией выборки,
+//     нельзя: отметка ждала бы ту же блокировку;
+//   - после ошибки отправки следующие команды того же сценария должны ждать повтора, а пачка,
+//     выбранная до ошибки, уже содержала бы их.
+//
+// Выборка одной строки идёт по индексу и дешевле отправки в Kafka, поэтому пропускную способность она не ограничивает
+func dispatchBatch(ctx context.Context, db *database.Database, machine *statemachine.Machine, producer *kafka.Producer, maxAttempts int) (int, error) {
+	for handled := 0; handled < outboxBatch; handled++ {
+		found, err := dispatchNext(ctx, db, machine, producer, maxAttempts)
+		if err != nil || !found {
+			return handled, err
+		}
+	}
+
+	return outboxBatch, nil
+}
 
-			for _, msg := range messages {
-				// Отправляем сообщение в Kafka
-				err = producer.SendOutboxMessageToKafka(&msg)
-				if err != nil {
-					log.Printf("Failed to send message to Kafka: %v", err)
-					continue
-				}
-
-				// Начинаем транзакцию
-				if err := db.InTx(ctx, func(ctx context.Context) error {
-					// Отмечаем сообщение как обработанное
-					if err := db.MarkOutboxMessageAsProcessed(msg.ID); err != nil {
-						log.Printf("Failed to mark outbox message as processed: %v", err)
-					}
-
-					// Обновляем статус
-					var status models.ScenarioStatus
-					if msg.Action == models.CommandStart {
-						status = models.StatusInStartupProcessing
-					} else {
-						status = models.StatusInShutdownProcessing
-					}
-					if err := db.UpdateScenarioStatus(ctx, msg.ScenarioID, status); err != nil {
-						log.Printf("Failed to update scenario status: %v", err)
-					}
-
-					return nil
-				}); err != nil {
-					log.Println(err)
-					return
-				}
+// dispatchNext отправляет самую раннюю готовую команду в отдельной короткой транзакции: строка outbox
+// заблокирована только на время одной отправки в Kafka, а отметка об отправке и смена статуса фиксируются
+// сразу после неё и не откатываются из-за ошибок с другими командами. Возвращает false, если отправлять нечего.
+// Команды сценария должны дойти до раннеров по порядку: после ошибки команда откладывается,
+// и следующие команды сценария ждут её
+func dispatchNext(ctx context.Context, db *database.Database, machine *statemachine.Machine, producer *kafka.Producer, maxAttempts int) (bool, error) {
+	found := false
+	err := db.InTx(ctx, func(ctx context.Context) error {
+		messages, err := db.LockPendingOutboxMessages(ctx, 1)
+		if err != nil {
+			return fmt.Errorf("failed to fetch outbox messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		found = true
+		msg := messages[0]
+
+		// Отправляем сообщение в Kafka
+		if err := producer.SendOutboxMessageToKafka(&msg); err != nil {
+			dispatchFailed.Add(1)
+			return recordFailure(ctx, db, machine, msg, err, maxAttempts)
+		}
+
+		latency := time.Since(msg.CreatedAt).Seconds()
+		dispatched.Add(1)
+		dispatchLatency.Set(latency)
+		dispatchLatencyTotal.Add(latency)
+
+		// Отмечаем сообщение как обработанное
+		if err := db.MarkOutboxMessageAsProcessed(ctx, msg.ID); err != nil {
+			return fmt.Errorf("failed to mark outbox message as processed: %w", err)
+		}
+
+		// Обновляем статус
+		event, ok := statemachine.SentEvent(msg.Action)
+		if !ok {
+			return nil
+		}
+		if _, err := machine.Fire(ctx, msg.ScenarioID, statemachine.Trigger{
+			Event: event,
+			Actor: statemachine.ActorOutbox,
+			Cause: fmt.Sprintf("command %s sent to runners", msg.Action),
+		}); err != nil {
+			if !errors.Is(err, statemachine.ErrInvalidTransition) {
+				return fmt.Errorf("failed to update scenario status: %w", err)
 			}
+			// Статус уже изменился, например остановка приостановленного сценария
+			log.Printf("Scenario %s status is not changed by sent command: %v", msg.ScenarioID, err)
 		}
+
+		return nil
+	})
+
+	return found, err
+}
+
+// recordFailure откладывает повторную отправку команды или, если попытки исчерпаны,
+// помечает её мёртвой и переводит сценарий в failed
+func recordFailure(ctx context.Context, db *database.Database, machine *statemachine.Machine, msg models.OutboxMessage, sendErr error, maxAttempts int) error {
+	attempt := msg.Attempts + 1
+	if maxAttempts <= 0 || attempt < maxAttempts {
+		delay := backoff(attempt)
+		log.Printf("Failed to send command %s of scenario %s (attempt %d), retrying in %v: %v",
+			msg.Action, msg.ScenarioID, attempt, delay, sendErr)
+		if err := db.RecordOutboxFailure(ctx, msg.ID, sendErr.Error(), delay); err != nil {
+			return fmt.Errorf("failed to record outbox failure: %w", err)
+		}
+		return nil
+	}
+
+	log.Printf("Command %s of scenario %s is dead after %d attempts: %v", msg.Action, msg.ScenarioID, attempt, sendErr)
+	deadCommands.Add(1)
+	if err := db.MarkOutboxMessageDead(ctx, msg, sendErr.Error()); err != nil {
+		return fmt.Errorf("failed to mark outbox message as dead: %w", err)
+	}
+
+	if _, err := machine.Fire(ctx, msg.ScenarioID, statemachine.Trigger{
+		Event: statemachine.EventCommandDead,
+		Actor: statemachine.ActorOutbox,
+		Cause: fmt.Sprintf("command %s was not sent after %d attempts: %v", msg.Action, attempt, sendErr),
+	}); err != nil {
+		if !errors.Is(err, statemachine.ErrInvalidTransition) {
+			return fmt.Errorf("failed to update scenario status: %w", err)
+		}
+		log.Printf("Scenario %s status is not changed by dead command: %v", msg.ScenarioID, err)
+	}
+
+	return nil
+}
+
+// backoff задержка перед попыткой, следующей за attempt неудачными
+func backoff(attempt int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
 	}
+	return min(delay, maxBackoff)
 }
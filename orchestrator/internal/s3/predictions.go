@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/minio/minio-go/v7"
+)
+
+// PredictionsBucket бакет, куда раннер пишет результаты как <scenario>/<кадр>.json,
+// а результаты повторных прогонов - как <scenario>/v<версия>/<кадр>.json
+const PredictionsBucket = "predictions"
+
+// predictionPrefix папка результатов сценария указанной версии
+func predictionPrefix(scenarioID string, version int) string {
+	if version == 0 {
+		return scenarioID + "/"
+	}
+	return fmt.Sprintf("%s/v%d/", scenarioID, version)
+}
+
+// ListPredictionFrames возвращает отсортированные индексы кадров, для которых есть результаты версии
+func (c *Client) ListPredictionFrames(ctx context.Context, scenarioID string, version int) ([]int, error) {
+	var frames []int
+	// Без Recursive папки других версий возвращаются одним префиксом и отбрасываются predictionFrame
+	for object := range c.client.ListObjects(ctx, PredictionsBucket, minio.ListObjectsOptions{
+		Prefix: predictionPrefix(scenarioID, version),
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		frame, ok := predictionFrame(object.Key)
+		if ok {
+			frames = append(frames, frame)
+		}
+	}
+
+	// Ключи в S3 отсортированы как строки, "10.json" раньше "2.json"
+	slices.Sort(frames)
+	return frames, nil
+}
+
+// GetPrediction читает результаты детекции одного кадра
+func (c *Client) GetPrediction(ctx context.Context, scenarioID string, version, frame int) ([]models.Detection, error) {
+	key := fmt.Sprintf("%s%d.json", predictionPrefix(scenarioID, version), frame)
+	object, err := c.client.GetObject(ctx, PredictionsBucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get prediction: %w", err)
+	}
+	defer object.Close()
+
+	var detections []models.Detection
+	if err := json.NewDecoder(object).Decode(&detections); err != nil {
+		return nil, fmt.Errorf("decode prediction for frame %d: %w", frame, err)
+	}
+	return detections, nil
+}
+
+// predictionFrame извлекает индекс кадра из ключа <scenario>/<кадр>.json
+func predictionFrame(key string) (int, bool) {
+	name, ok := strings.CutSuffix(path.Base(key), ".json")
+	if !ok {
+		return 0, false
+	}
+
+	frame, err := strconv.Atoi(name)
+	return frame, err == nil
+}
+
+// PredictionEvent уведомление о записи результатов кадра
+type PredictionEvent struct {
+	Frame int
+	Err   error
+}
+
+// ListenPredictions подписывается на уведомления MinIO о новых результатах сценария указанной версии.
+// Канал закрывается при отмене контекста или после ошибки подписки
+func (c *Client) ListenPredictions(ctx context.Context, scenarioID string, version int) <-chan PredictionEvent {
+	events := make(chan PredictionEvent)
+	prefix := predictionPrefix(scenarioID, version)
+
+	go func() {
+		defer close(events)
+
+		for info := range c.client.ListenBucketNotification(ctx, PredictionsBucket, prefix, ".json", []string{
+			"s3:ObjectCreated:*",
+		}) {
+			if info.Err != nil {
+				select {
+				case events <- PredictionEvent{Err: info.Err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			for _, record := range info.Records {
+				// Ключ объекта в уведомлении закодирован как в URL
+				key, err := url.QueryUnescape(record.S3.Object.Key)
+				// Префикс исходной версии совпадает с началом ключей повторных прогонов
+				if err != nil || path.Dir(key)+"/" != prefix {
+					continue
+				}
+				frame, ok := predictionFrame(key)
+				if !ok {
+					continue
+				}
+
+				select {
+				case events <- PredictionEvent{Frame: frame}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events
+}
@@ -4,11 +4,19 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+// FramesBucket бакет, куда ingest загружает кадры как <scenario>/<кадр>.jpg
+const FramesBucket = "frames"
+
+// UploadsBucket бакет, где загруженное через API видео хранится как <scenario>/video до извлечения кадров.
+// Извлечение может продолжить любой экземпляр оркестратора, а не только принявший файл
+const UploadsBucket = "uploads"
+
 type Client struct {
 	client *minio.Client
 }
@@ -58,3 +66,108 @@ func (c *Client) UploadFileStream(ctx context.Context, bucketName, objectName st
 	url := fmt.Sprintf("http://%s/%s/%s", c.client.EndpointURL().Host, bucketName, objectName)
 	return url, nil
 }
+
+// HasObjects проверяет, есть ли в бакете хотя бы один объект с указанным префиксом
+func (c *Client) HasObjects(ctx context.Context, bucketName, prefix string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range c.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+		MaxKeys:   1,
+	}) {
+		if object.Err != nil {
+			return false, object.Err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// DownloadFile скачивает объект из S3 в локальный файл
+func (c *Client) DownloadFile(ctx context.Context, bucketName, objectName, filePath string) error {
+	if err := c.client.FGetObject(ctx, bucketName, objectName, filePath, minio.GetObjectOptions{}); err != nil {
+		return fmt.Errorf("download error: %w", err)
+	}
+	return nil
+}
+
+// PresignedGetURL возвращает временную ссылку на объект, которую можно передать внешним утилитам
+func (c *Client) PresignedGetURL(ctx context.Context, bucketName, objectName string, expires time.Duration) (string, error) {
+	u, err := c.client.PresignedGetObject(ctx, bucketName, objectName, expires, nil)
+	if err != nil {
+		return "", fmt.Errorf("presign error: %w", err)
+	}
+	return u.String(), nil
+}
+
+// removeBatch сколько объектов удаляется одним запросом
+const removeBatch = 1000
+
+// RemovePrefix удаляет все объекты бакета с указанным префиксом пачками.
+// removed вызывается после каждой удалённой пачки с её размером.
+// Отсутствующий бакет означает, что удалять нечего
+func (c *Client) RemovePrefix(ctx context.Context, bucketName, prefix string, removed func(n int)) error {
+	batch := make([]minio.ObjectInfo, 0, removeBatch)
+	flush := func() error {
+		objects := make(chan minio.ObjectInfo, len(batch))
+		for _, object := range batch {
+			objects <- object
+		}
+		close(objects)
+
+		for result := range c.client.RemoveObjects(ctx, bucketName, objects, minio.RemoveObjectsOptions{}) {
+			if result.Err != nil {
+				return fmt.Errorf("remove %s: %w", result.ObjectName, result.Err)
+			}
+		}
+		removed(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for object := range c.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			if minio.ToErrorResponse(object.Err).Code == "NoSuchBucket" {
+				return nil
+			}
+			return object.Err
+		}
+
+		batch = append(batch, object)
+		if len(batch) == removeBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(batch) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// CountPrefix возвращает число объектов бакета с указанным префиксом
+func (c *Client) CountPrefix(ctx context.Context, bucketName, prefix string) (int, error) {
+	count := 0
+	for object := range c.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			if minio.ToErrorResponse(object.Err).Code == "NoSuchBucket" {
+				return 0, nil
+			}
+			return 0, object.Err
+		}
+		count++
+	}
+
+	return count, nil
+}
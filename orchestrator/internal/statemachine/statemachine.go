@@ -0,0 +1,341 @@
+package statemachine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+// Event событие, которое может изменить статус сценария
+type Event string
+
+const (
+	EventCreate          Event = "create"           // сценарий создан
+	EventStart           Event = "start"            // запуск по запросу пользователя
+	EventStop            Event = "stop"             // остановка по запросу пользователя
+	EventReprocessFailed Event = "reprocess_failed" // повторная обработка упавших кадров
+	EventPause           Event = "pause"            // приостановка по запросу пользователя
+	EventResume          Event = "resume"           // продолжение по запросу пользователя
+	EventReplay          Event = "replay"           // повторная детекция диапазона кадров
+	EventDelete          Event = "delete"           // удаление сценария по запросу пользователя
+	EventStartSent       Event = "start_sent"       // outbox отправил раннерам команду запуска
+	EventStopSent        Event = "stop_sent"        // outbox отправил раннерам команду остановки
+	EventRunnerStarted   Event = "runner_started"   // раннер прислал heartbeat запущенного сценария
+	EventRunnerStopped   Event = "runner_stopped"   // раннер остановил или завершил сценарий
+	EventRunnerPaused    Event = "runner_paused"    // раннер освободил слот приостановленного сценария
+	EventRunnerLost      Event = "runner_lost"      // от раннера давно нет heartbeat
+	EventIngestDone      Event = "ingest_done"      // кадры извлечены из видео
+	EventIngestFailed    Event = "ingest_failed"    // извлечь кадры не удалось
+	EventCommandDead     Event = "command_dead"     // outbox исчерпал попытки отправки команды
+	EventRequeueStart    Event = "requeue_start"    // мёртвая команда запуска поставлена в очередь заново
+	EventRequeueStop     Event = "requeue_stop"     // мёртвая команда остановки поставлена в очередь заново
+	EventRequeuePause    Event = "requeue_pause"    // мёртвая команда паузы поставлена в очередь заново
+)
+
+// Инициаторы переходов
+const (
+	ActorAPI      = "api"
+	ActorOutbox   = "outbox"
+	ActorRunner   = "runner"
+	ActorWatchdog = "watchdog"
+	ActorIngest   = "ingest"
+	ActorAdmin    = "admin"
+)
+
+// ErrInvalidTransition событие недопустимо в текущем статусе сценария
+var ErrInvalidTransition = errors.New("invalid transition")
+
+// transition переход и его побочные эффекты
+type transition struct {
+	to models.ScenarioStatus
+	// command команда раннерам, которая ставится в outbox вместе со сменой статуса
+	command models.CommandAction
+	// cancelPending отменяет ещё не отправленную команду сценария
+	cancelPending bool
+	// reissue повторяет команду, запустившую текущий прогон сценария, вместе с её параметрами.
+	// command отправляется, если такой команды нет
+	reissue bool
+	// mainRunOnly переход допустим, только если прогон начат командой start или resume. Прогоны replay
+	// и reprocess_failed нельзя продолжить с checkpoint основной обработки, поэтому их нельзя приостановить
+	mainRunOnly bool
+	// sending переход вместо этого, если отменять нечего: команду в этот момент отправляет outbox
+	sending *transition
+}
+
+// deleteTransition удаление сценария: раннер останавливает сценарий, если тот ещё работает,
+// и подтверждает удаление heartbeat. Неотправленная команда запуска отменяется.
+// Во время извлечения кадров удаление запрещено, иначе ingest загрузит кадры уже после очистки
+var deleteTransition = transition{to: models.StatusDeleting, command: models.CommandDelete, cancelPending: true}
+
+// deadTransition команда сценария не дошла до раннеров. Во время удаления это не ошибка:
+// cleanup удалит данные и без подтверждения раннеров
+var deadTransition = transition{to: models.StatusFailed}
+
+// transitions единственное место, где описаны допустимые переходы между статусами
+var transitions = map[models.ScenarioStatus]map[Event]transition{
+	models.StatusIngesting: {
+		EventIngestDone:   {to: models.StatusInitStartup, command: models.CommandStart},
+		EventIngestFailed: {to: models.StatusIngestFailed},
+	},
+	models.StatusIngestFailed: {
+		EventDelete: deleteTransition,
+	},
+	models.StatusInitStartup: {
+		EventStartSent: {to: models.StatusInStartupProcessing},
+		// Раннер ещё не получил команду запуска, останавливать нечего.
+		// Если команда уже отправляется, раннер должен получить и команду остановки
+		EventStop: {
+			to:            models.StatusInactive,
+			cancelPending: true,
+			sending:       &transition{to: models.StatusInitShutdown, command: models.CommandStop},
+		},
+		// Раннер ещё не получил команду запуска, отменить её достаточно.
+		// Если команда уже отправляется, раннер должен получить и команду паузы
+		EventPause: {
+			to:            models.StatusPaused,
+			cancelPending: true,
+			mainRunOnly:   true,
+			sending:       &transition{to: models.StatusPausing, command: models.CommandPause, mainRunOnly: true},
+		},
+		EventDelete:      deleteTransition,
+		EventCommandDead: deadTransition,
+	},
+	models.StatusInStartupProcessing: {
+		EventRunnerStarted: {to: models.StatusActive},
+		// Короткое видео может закончиться раньше первого heartbeat о работе
+		EventRunnerStopped: {to: models.StatusInactive},
+		// Раннер взял команду и пропал, не успев прислать heartbeat
+		EventRunnerLost:  {to: models.StatusInitStartup, command: models.CommandStart, reissue: true},
+		EventStop:        {to: models.StatusInitShutdown, command: models.CommandStop},
+		EventPause:       {to: models.StatusPausing, command: models.CommandPause, mainRunOnly: true},
+		EventDelete:      deleteTransition,
+		EventCommandDead: deadTransition,
+	},
+	models.StatusActive: {
+		EventRunnerStopped: {to: models.StatusInactive},
+		// Прогон продолжается той же командой: replay и reprocess_failed не должны превращаться в обычный запуск
+		EventRunnerLost:  {to: models.StatusInitStartup, command: models.CommandStart, reissue: true},
+		EventStop:        {to: models.StatusInitShutdown, command: models.CommandStop},
+		EventPause:       {to: models.StatusPausing, command: models.CommandPause, mainRunOnly: true},
+		EventDelete:      deleteTransition,
+		EventCommandDead: deadTransition,
+	},
+	// Раннер ещё дорабатывает сценарий и сохраняет checkpoint, продолжить его до подтверждения паузы нельзя
+	models.StatusPausing: {
+		EventRunnerPaused: {to: models.StatusPaused},
+		// Сценарий успел завершиться до получения команды паузы
+		EventRunnerStopped: {to: models.StatusInactive},
+		// Раннер пропал, checkpoint остался на последнем сохранённом кадре
+		EventRunnerLost:  {to: models.StatusPaused},
+		EventStop:        {to: models.StatusInitShutdown, command: models.CommandStop},
+		EventDelete:      deleteTransition,
+		EventCommandDead: deadTransition,
+	},
+	models.StatusPaused: {
+		// Повторное подтверждение раннера не меняет статус, но попадает в историю вместе с кадром
+		EventRunnerPaused: {to: models.StatusPaused},
+		EventResume:       {to: models.StatusInitStartup, command: models.CommandResume},
+		// Раннер уже освободил сценарий, ждать подтверждения остановки не нужно
+		EventStop:        {to: models.StatusInactive, command: models.CommandStop},
+		EventDelete:      deleteTransition,
+		EventCommandDead: deadTransition,
+	},
+	models.StatusInitShutdown: {
+		EventStopSent: {to: models.StatusInShutdownProcessing},
+		// Сценарий завершился сам до отправки команды остановки
+		EventRunnerStopped: {to: models.StatusInactive, cancelPending: true},
+		// Остановка во время паузы: раннер уже освободил сценарий
+		EventRunnerPaused: {to: models.StatusInactive, cancelPending: true},
+		EventStart:        {to: models.StatusInitStartup, command: models.CommandStart, cancelPending: true},
+		EventDelete:       deleteTransition,
+		EventCommandDead:  deadTransition,
+	},
+	models.StatusInShutdownProcessing: {
+		EventRunnerStopped: {to: models.StatusInactive},
+		EventRunnerPaused:  {to: models.StatusInactive},
+		// Подтверждения остановки нет: сценарий не обрабатывался ни одним раннером или раннер пропал
+		EventRunnerLost:  {to: models.StatusInactive},
+		EventStart:       {to: models.StatusInitStartup, command: models.CommandStart},
+		EventDelete:      deleteTransition,
+		EventCommandDead: deadTransition,
+	},
+	models.StatusInactive: {
+		EventStart:           {to: models.StatusInitStartup, command: models.CommandStart},
+		EventReprocessFailed: {to: models.StatusInitStartup, command: models.CommandReprocessFailed},
+		EventReplay:          {to: models.StatusInitStartup, command: models.CommandReplay},
+		EventDelete:          deleteTransition,
+		// Команда остановки приостановленного сценария отправляется уже в inactive
+		EventCommandDead: deadTransition,
+	},
+	models.StatusFailed: {
+		// Мёртвая команда снова отправляется, сценарий возвращается в статус ожидания её отправки
+		EventRequeueStart: {to: models.StatusInitStartup},
+		EventRequeueStop:  {to: models.StatusInitShutdown},
+		EventRequeuePause: {to: models.StatusPausing},
+		// Действие пользователя отменяет мёртвую команду
+		EventStart: {to: models.StatusInitStartup, command: models.CommandStart, cancelPending: true},
+		// Неизвестно, работает ли сценарий у раннера, поэтому команда остановки отправляется без ожидания подтверждения
+		EventStop:          {to: models.StatusInactive, command: models.CommandStop, cancelPending: true},
+		EventRunnerStopped: {to: models.StatusInactive, cancelPending: true},
+		EventDelete:        deleteTransition,
+	},
+}
+
+// SentEvent возвращает событие, которым outbox сообщает об отправке команды раннерам.
+// Отправка команд паузы и удаления статус не меняет
+func SentEvent(action models.CommandAction) (Event, bool) {
+	switch action {
+	case models.CommandStop:
+		return EventStopSent, true
+	case models.CommandPause, models.CommandDelete:
+		return "", false
+	default:
+		return EventStartSent, true
+	}
+}
+
+// RequeueEvent возвращает событие, которым повторная отправка мёртвой команды возвращает сценарий из failed
+func RequeueEvent(action models.CommandAction) Event {
+	switch action {
+	case models.CommandStop:
+		return EventRequeueStop
+	case models.CommandPause:
+		return EventRequeuePause
+	default:
+		return EventRequeueStart
+	}
+}
+
+// Can сообщает, допустимо ли событие в статусе from
+func Can(from models.ScenarioStatus, event Event) bool {
+	_, ok := transitions[from][event]
+	return ok
+}
+
+// Trigger событие вместе с его контекстом для истории переходов
+type Trigger struct {
+	Event Event
+	Actor string
+	Cause string
+	// Payload параметры команды раннерам, если переход её отправляет
+	Payload models.CommandPayload
+}
+
+// Machine применяет переходы к сценариям и записывает их в историю
+type Machine struct {
+	db *database.Database
+}
+
+func New(db *database.Database) *Machine {
+	return &Machine{db: db}
+}
+
+// Create сохраняет новый сценарий и первую запись его истории.
+// Сценарий в статусе init_startup сразу получает команду запуска
+func (m *Machine) Create(ctx context.Context, scenario *models.Scenario, actor, cause string) error {
+	return m.db.InTx(ctx, func(ctx context.Context) error {
+		if err := m.db.CreateScenario(ctx, scenario); err != nil {
+			return fmt.Errorf("failed to insert scenario: %w", err)
+		}
+
+		if err := m.db.AddTransition(ctx, models.Transition{
+			ScenarioID: scenario.ID,
+			To:         scenario.Status,
+			Event:      string(EventCreate),
+			Actor:      actor,
+			Cause:      cause,
+		}); err != nil {
+			return fmt.Errorf("failed to record transition: %w", err)
+		}
+
+		if scenario.Status == models.StatusInitStartup {
+			if err := m.db.AddToOutbox(ctx, scenario.ID, models.CommandStart); err != nil {
+				return fmt.Errorf("failed to add to outbox: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Fire применяет событие к сценарию и возвращает новый статус.
+// Смена статуса, запись в историю и команда раннерам фиксируются в одной транзакции.
+// Если событие недопустимо в текущем статусе, возвращается ErrInvalidTransition
+func (m *Machine) Fire(ctx context.Context, scenarioID string, trigger Trigger) (models.ScenarioStatus, error) {
+	var to models.ScenarioStatus
+	err := m.db.InTx(ctx, func(ctx context.Context) error {
+		// Блокируем сценарий, чтобы параллельные события применялись по очереди
+		from, err := m.db.LockScenarioStatus(ctx, scenarioID)
+		if err != nil {
+			return err
+		}
+
+		tr, ok := transitions[from][trigger.Event]
+		if !ok {
+			return fmt.Errorf("%w: %s from status %s", ErrInvalidTransition, trigger.Event, from)
+		}
+
+		if tr.mainRunOnly {
+			action, _, err := m.db.GetLastRunCommand(ctx, scenarioID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("failed to get last run command: %w", err)
+			}
+			if action == models.CommandReplay || action == models.CommandReprocessFailed {
+				return fmt.Errorf("%w: %s is not allowed during %s", ErrInvalidTransition, trigger.Event, action)
+			}
+		}
+
+		if tr.cancelPending {
+			// Команду, которую сейчас отправляет outbox, отменить нельзя: её строка заблокирована.
+			// Ожидать блокировку тоже нельзя, outbox после отправки блокирует сценарий
+			cancelled, err := m.db.MarkOutboxMessageProcessedByScenarioID(ctx, scenarioID)
+			if err != nil {
+				return err
+			}
+			if !cancelled && tr.sending != nil {
+				tr = *tr.sending
+			}
+		}
+		to = tr.to
+
+		if err := m.db.UpdateScenarioStatus(ctx, scenarioID, tr.to); err != nil {
+			return err
+		}
+
+		if err := m.db.AddTransition(ctx, models.Transition{
+			ScenarioID: scenarioID,
+			From:       from,
+			To:         tr.to,
+			Event:      string(trigger.Event),
+			Actor:      trigger.Actor,
+			Cause:      trigger.Cause,
+		}); err != nil {
+			return fmt.Errorf("failed to record transition: %w", err)
+		}
+
+		command, payload := tr.command, trigger.Payload
+		if tr.reissue {
+			action, p, err := m.db.GetLastRunCommand(ctx, scenarioID)
+			switch {
+			case err == nil:
+				command, payload = action, p
+			case !errors.Is(err, sql.ErrNoRows):
+				return fmt.Errorf("failed to get last run command: %w", err)
+			}
+		}
+
+		if command != "" {
+			if err := m.db.AddCommandToOutbox(ctx, scenarioID, command, payload); err != nil {
+				return fmt.Errorf("failed to add to outbox: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	return to, err
+}
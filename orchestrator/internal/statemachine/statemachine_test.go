@@ -0,0 +1,226 @@
+package statemachine
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+)
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		from    models.ScenarioStatus
+		event   Event
+		to      models.ScenarioStatus
+		command models.CommandAction
+	}{
+		{from: models.StatusIngesting, event: EventIngestDone, to: models.StatusInitStartup, command: models.CommandStart},
+		{from: models.StatusIngesting, event: EventIngestFailed, to: models.StatusIngestFailed},
+		{from: models.StatusInitStartup, event: EventStartSent, to: models.StatusInStartupProcessing},
+		{from: models.StatusInStartupProcessing, event: EventRunnerStarted, to: models.StatusActive},
+		{from: models.StatusInStartupProcessing, event: EventRunnerStopped, to: models.StatusInactive},
+		{from: models.StatusInStartupProcessing, event: EventRunnerLost, to: models.StatusInitStartup, command: models.CommandStart},
+		{from: models.StatusActive, event: EventRunnerLost, to: models.StatusInitStartup, command: models.CommandStart},
+		{from: models.StatusActive, event: EventStop, to: models.StatusInitShutdown, command: models.CommandStop},
+		{from: models.StatusActive, event: EventRunnerStopped, to: models.StatusInactive},
+		{from: models.StatusInitShutdown, event: EventStopSent, to: models.StatusInShutdownProcessing},
+		{from: models.StatusInitShutdown, event: EventStart, to: models.StatusInitStartup, command: models.CommandStart},
+		{from: models.StatusInShutdownProcessing, event: EventRunnerStopped, to: models.StatusInactive},
+		{from: models.StatusInShutdownProcessing, event: EventRunnerLost, to: models.StatusInactive},
+		{from: models.StatusInactive, event: EventStart, to: models.StatusInitStartup, command: models.CommandStart},
+		{from: models.StatusInactive, event: EventDelete, to: models.StatusDeleting, command: models.CommandDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"/"+string(tt.event), func(t *testing.T) {
+			tr, ok := transitions[tt.from][tt.event]
+			if !ok {
+				t.Fatalf("transition is not allowed")
+			}
+			if tr.to != tt.to || tr.command != tt.command {
+				t.Errorf("got %s with command %q, want %s with command %q", tr.to, tr.command, tt.to, tt.command)
+			}
+		})
+	}
+}
+
+// TestStopBeforeStartSent остановка до отправки команды запуска отменяет её и не ждёт раннер,
+// а во время отправки ставит в очередь команду остановки
+func TestStopBeforeStartSent(t *testing.T) {
+	tr := transitions[models.StatusInitStartup][EventStop]
+	if !tr.cancelPending || tr.to != models.StatusInactive || tr.command != "" {
+		t.Errorf("got %+v, want cancel to inactive without command", tr)
+	}
+	if tr.sending == nil || tr.sending.to != models.StatusInitShutdown || tr.sending.command != models.CommandStop {
+		t.Errorf("got sending %+v, want init_shutdown with stop command", tr.sending)
+	}
+}
+
+// TestRunnerLostReissues после потери раннера повторяется команда, запустившая прогон
+func TestRunnerLostReissues(t *testing.T) {
+	for _, from := range []models.ScenarioStatus{models.StatusInStartupProcessing, models.StatusActive} {
+		if !transitions[from][EventRunnerLost].reissue {
+			t.Errorf("%s: runner_lost does not reissue the run command", from)
+		}
+	}
+}
+
+func TestInvalidTransitions(t *testing.T) {
+	tests := []struct {
+		from  models.ScenarioStatus
+		event Event
+	}{
+		// Во время извлечения кадров сценарий не запускается и не удаляется
+		{from: models.StatusIngesting, event: EventStart},
+		{from: models.StatusIngesting, event: EventDelete},
+		{from: models.StatusIngestFailed, event: EventStart},
+		{from: models.StatusActive, event: EventStart},
+		{from: models.StatusActive, event: EventIngestDone},
+		{from: models.StatusInactive, event: EventStop},
+		{from: models.StatusInactive, event: EventRunnerLost},
+		{from: models.StatusInitStartup, event: EventRunnerStarted},
+		{from: models.StatusInitShutdown, event: EventRunnerLost},
+		{from: models.StatusDeleting, event: EventStart},
+		{from: models.StatusDeleting, event: EventDelete},
+		{from: models.StatusDeleting, event: EventCommandDead},
+	}
+
+	for _, tt := range tests {
+		if Can(tt.from, tt.event) {
+			t.Errorf("%s is allowed from status %s", tt.event, tt.from)
+		}
+	}
+}
+
+// TestTransitionTargets переходы ведут только в известные статусы
+func TestTransitionTargets(t *testing.T) {
+	for from, events := range transitions {
+		if !slices.Contains(models.Statuses, from) {
+			t.Errorf("unknown status %s", from)
+		}
+		for event, tr := range events {
+			if !slices.Contains(models.Statuses, tr.to) {
+				t.Errorf("%s/%s: unknown target status %s", from, event, tr.to)
+			}
+			if tr.sending != nil && !slices.Contains(models.Statuses, tr.sending.to) {
+				t.Errorf("%s/%s: unknown sending target status %s", from, event, tr.sending.to)
+			}
+		}
+	}
+}
+
+func TestSentEvent(t *testing.T) {
+	tests := []struct {
+		action models.CommandAction
+		event  Event
+		ok     bool
+	}{
+		{action: models.CommandStart, event: EventStartSent, ok: true},
+		{action: models.CommandStop, event: EventStopSent, ok: true},
+		{action: models.CommandDelete, ok: false},
+	}
+
+	for _, tt := range tests {
+		event, ok := SentEvent(tt.action)
+		if event != tt.event || ok != tt.ok {
+			t.Errorf("SentEvent(%s) = %q, %v, want %q, %v", tt.action, event, ok, tt.event, tt.ok)
+		}
+	}
+}
+
+func TestPauseTransitions(t *testing.T) {
+	tests := []struct {
+		from    models.ScenarioStatus
+		event   Event
+		to      models.ScenarioStatus
+		command models.CommandAction
+	}{
+		{from: models.StatusInStartupProcessing, event: EventPause, to: models.StatusPausing, command: models.CommandPause},
+		{from: models.StatusActive, event: EventPause, to: models.StatusPausing, command: models.CommandPause},
+		{from: models.StatusPausing, event: EventRunnerPaused, to: models.StatusPaused},
+		// Checkpoint остался на последнем сохранённом кадре, продолжить можно с него
+		{from: models.StatusPausing, event: EventRunnerLost, to: models.StatusPaused},
+		{from: models.StatusPausing, event: EventRunnerStopped, to: models.StatusInactive},
+		{from: models.StatusPaused, event: EventResume, to: models.StatusInitStartup, command: models.CommandResume},
+		{from: models.StatusPaused, event: EventStop, to: models.StatusInactive, command: models.CommandStop},
+		{from: models.StatusInitShutdown, event: EventRunnerPaused, to: models.StatusInactive},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"/"+string(tt.event), func(t *testing.T) {
+			tr, ok := transitions[tt.from][tt.event]
+			if !ok {
+				t.Fatalf("transition is not allowed")
+			}
+			if tr.to != tt.to || tr.command != tt.command {
+				t.Errorf("got %s with command %q, want %s with command %q", tr.to, tr.command, tt.to, tt.command)
+			}
+		})
+	}
+
+	// Пока команда запуска не отправлена, её достаточно отменить
+	tr := transitions[models.StatusInitStartup][EventPause]
+	if !tr.cancelPending || tr.to != models.StatusPaused || tr.sending == nil || tr.sending.to != models.StatusPausing {
+		t.Errorf("init_startup/pause: got %+v", tr)
+	}
+
+	// До подтверждения паузы продолжить сценарий нельзя
+	for _, event := range []Event{EventResume, EventStart, EventPause} {
+		if Can(models.StatusPausing, event) {
+			t.Errorf("%s is allowed from status pausing", event)
+		}
+	}
+
+	if event, ok := SentEvent(models.CommandPause); ok {
+		t.Errorf("SentEvent(pause) = %q, want no event", event)
+	}
+}
+
+// TestPauseOnlyMainRun replay и reprocess_failed не продолжаются с checkpoint, поэтому пауза
+// допустима только для прогона, начатого start или resume
+func TestPauseOnlyMainRun(t *testing.T) {
+	for from, events := range transitions {
+		tr, ok := events[EventPause]
+		if !ok {
+			continue
+		}
+		if !tr.mainRunOnly || (tr.sending != nil && !tr.sending.mainRunOnly) {
+			t.Errorf("%s: pause is allowed during replay", from)
+		}
+	}
+
+	if !Can(models.StatusInactive, EventReplay) || Can(models.StatusActive, EventReplay) {
+		t.Error("replay must be allowed only from status inactive")
+	}
+}
+
+// TestDeadCommand мёртвая команда переводит сценарий в failed, а повторная постановка в очередь
+// возвращает его в статус ожидания отправки этой команды
+func TestDeadCommand(t *testing.T) {
+	for from, events := range transitions {
+		switch from {
+		case models.StatusIngesting, models.StatusIngestFailed, models.StatusFailed:
+			continue
+		}
+		if tr, ok := events[EventCommandDead]; !ok || tr.to != models.StatusFailed {
+			t.Errorf("%s: command_dead does not lead to failed", from)
+		}
+	}
+
+	tests := []struct {
+		action models.CommandAction
+		to     models.ScenarioStatus
+	}{
+		{action: models.CommandStart, to: models.StatusInitStartup},
+		{action: models.CommandResume, to: models.StatusInitStartup},
+		{action: models.CommandReplay, to: models.StatusInitStartup},
+		{action: models.CommandStop, to: models.StatusInitShutdown},
+		{action: models.CommandPause, to: models.StatusPausing},
+	}
+	for _, tt := range tests {
+		tr, ok := transitions[models.StatusFailed][RequeueEvent(tt.action)]
+		if !ok || tr.to != tt.to || tr.command != "" {
+			t.Errorf("requeue of %s: got %+v, want %s without a new command", tt.action, tr, tt.to)
+		}
+	}
+}
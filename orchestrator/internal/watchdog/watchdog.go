@@ -2,22 +2,30 @@ package watchdog
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/database"
 	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/models"
+	"github.com/Capitan-Parrot/distributed-video-system/orhestrator/internal/statemachine"
 )
 
 const watchInterval = 30 * time.Second
 
+// processingTimeout сколько ждать первого heartbeat после отправки команды запуска или остановки.
+// Раннер может быть занят другими сценариями, поэтому ожидание дольше, чем для работающего сценария
+const processingTimeout = 2 * time.Minute
+
 type Watchdog struct {
-	db *database.Database
+	db      *database.Database
+	machine *statemachine.Machine
 }
 
-func New(db *database.Database) *Watchdog {
+func New(db *database.Database, machine *statemachine.Machine) *Watchdog {
 	return &Watchdog{
-		db: db,
+		db:      db,
+		machine: machine,
 	}
 }
 
@@ -37,22 +45,27 @@ func (w *Watchdog) Start(ctx context.Context) {
 }
 
 func (w *Watchdog) checkScenarios(ctx context.Context) {
-	scenarios, err := w.db.FindStuckScenarios(ctx, watchInterval)
+	w.fireLost(ctx, watchInterval, models.StatusActive, models.StatusPausing)
+	w.fireLost(ctx, processingTimeout, models.StatusInStartupProcessing, models.StatusInShutdownProcessing)
+}
+
+// fireLost сообщает о потере раннера сценариям в статусах statuses без heartbeat дольше interval
+func (w *Watchdog) fireLost(ctx context.Context, interval time.Duration, statuses ...models.ScenarioStatus) {
+	scenarios, err := w.db.FindStuckScenarios(ctx, interval, statuses...)
 	if err != nil {
 		log.Printf("Failed to find stuck scenarios: %v", err)
 		return
 	}
 
 	for _, scenario := range scenarios {
-		log.Printf("Found stuck scenario %s, sending restart command", scenario.ID)
-
-		if err := w.db.AddToOutbox(ctx, scenario.ID, models.CommandStart); err != nil {
-			log.Printf("Failed to add restart command to outbox: %v", err)
-			continue
-		}
+		log.Printf("Found stuck scenario %s in status %s", scenario.ID, scenario.Status)
 
-		if err := w.db.UpdateScenarioStatus(ctx, scenario.ID, models.StatusInitStartup); err != nil {
-			log.Printf("Failed to update scenario status: %v", err)
+		if _, err := w.machine.Fire(ctx, scenario.ID, statemachine.Trigger{
+			Event: statemachine.EventRunnerLost,
+			Actor: statemachine.ActorWatchdog,
+			Cause: fmt.Sprintf("no heartbeat for %v", interval),
+		}); err != nil {
+			log.Printf("Failed to handle stuck scenario %s: %v", scenario.ID, err)
 		}
 	}
 }
@@ -58,12 +58,27 @@ func main() {
 	}
 	defer producer.Close()
 
+	// Kafka producer for detection results
+	var resultsProducer *kafka.Producer
+	if cfg.Kafka.ResultsTopic != "" {
+		resultsProducer, err = kafka.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.ResultsTopic)
+		if err != nil {
+			log.Fatalf("Failed to create Kafka results producer: %v", err)
+		}
+		defer resultsProducer.Close()
+	}
+
 	detectClient := detection.NewClient(cfg.Detection.Endpoint)
 
-	r := runner.New(db, s3Client, detectClient, consumer, producer)
+	r := runner.New(db, s3Client, detectClient, consumer, producer, resultsProducer, runner.Options{
+		FramesInFlight:    cfg.Runner.FramesInFlight,
+		MaxInFlightFrames: cfg.Runner.MaxInFlightFrames,
+		StreamSampleFPS:   cfg.Runner.StreamSampleFPS,
+	})
 	go r.ListenAndRun(ctx)
 
 	go r.ProcessStopEvent(ctx)
+	go r.PruneCommandLedger(ctx)
 
 	// Wait for shutdown signal
 	stop := make(chan os.Signal, 1)
@@ -3,6 +3,7 @@ module github.com/Capitan-Parrot/distributed-video-system/runner
 go 1.24.0
 
 require (
+	github.com/Capitan-Parrot/distributed-video-system/contract v0.0.0
 	github.com/IBM/sarama v1.43.3
 	github.com/caarlos0/env/v11 v11.2.2
 	github.com/lib/pq v1.10.9
@@ -42,3 +43,5 @@ require (
 	golang.org/x/sys v0.24.0 // indirect
 	golang.org/x/text v0.17.0 // indirect
 )
+
+replace github.com/Capitan-Parrot/distributed-video-system/contract => ../contract
@@ -25,8 +25,15 @@ type Config struct {
 		GroupID        string   `yaml:"group_id" env:"KAFKA_GROUP_ID"`
 		ScenarioTopic  string   `yaml:"scenario_topic" env:"SCENARIO_TOPIC"`
 		HeartbeatTopic string   `yaml:"heartbeat_topic" env:"HEARTBEAT_TOPIC"`
+		ResultsTopic   string   `yaml:"results_topic" env:"RESULTS_TOPIC"` // пустой - результаты только в S3
 	} `yaml:"kafka"`
 
+	Runner struct {
+		FramesInFlight    int     `yaml:"frames_in_flight" env:"FRAMES_IN_FLIGHT"`
+		MaxInFlightFrames int     `yaml:"max_in_flight_frames" env:"MAX_IN_FLIGHT_FRAMES"`
+		StreamSampleFPS   float64 `yaml:"stream_sample_fps" env:"STREAM_SAMPLE_FPS"`
+	} `yaml:"runner"`
+
 	Detection struct {
 		Endpoint string `yaml:"endpoint" env:"DETECTION_ENDPOINT"`
 	} `yaml:"detection"`
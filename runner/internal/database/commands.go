@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
+)
+
+// ClaimCommand records the command in the processed commands ledger.
+// Returns false if the command has already been processed. Called in the transaction
+// that applies the command, so a concurrent redelivery waits for it and then sees the record
+func (d *Database) ClaimCommand(ctx context.Context, cmd models.ScenarioCommand) (bool, error) {
+	result, err := d.querier(ctx).ExecContext(ctx,
+		`INSERT INTO processed_commands (id, scenario_id, action, processed_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING`,
+		cmd.ID,
+		cmd.ScenarioID,
+		cmd.Action,
+		time.Now(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+// PruneProcessedCommands removes ledger records older than before and returns their number
+func (d *Database) PruneProcessedCommands(ctx context.Context, before time.Time) (int64, error) {
+	result, err := d.querier(ctx).ExecContext(ctx, "DELETE FROM processed_commands WHERE processed_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
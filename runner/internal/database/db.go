@@ -36,6 +36,17 @@ func (d *Database) Init() error {
 		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP NOT NULL
 	);
+
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS last_frame INTEGER NOT NULL DEFAULT -1;
+	ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS failed_frames INTEGER[] NOT NULL DEFAULT '{}';
+
+	CREATE TABLE IF NOT EXISTS processed_commands (
+		id TEXT PRIMARY KEY,
+		scenario_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS processed_commands_processed_at_idx ON processed_commands (processed_at);
 	`
 
 	_, err := d.DB.Exec(createTables)
@@ -8,14 +8,15 @@ import (
 	"time"
 
 	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
+	"github.com/lib/pq"
 )
 
-func (d *Database) CreateScenario(scenario *models.Scenario) error {
+func (d *Database) CreateScenario(ctx context.Context, scenario *models.Scenario) error {
 	now := time.Now()
 	scenario.CreatedAt = now
 	scenario.UpdatedAt = now
 
-	_, err := d.DB.Exec(
+	_, err := d.querier(ctx).ExecContext(ctx,
 		`INSERT INTO scenarios (id, action, video_source, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) 
 			 	ON CONFLICT (id) DO UPDATE SET action = $6, updated_at = NOW()`,
 		scenario.ID,
@@ -29,9 +30,9 @@ func (d *Database) CreateScenario(scenario *models.Scenario) error {
 	return err
 }
 
-func (d *Database) GetScenario(scenarioID string) (*models.Scenario, error) {
-	row := d.DB.QueryRow(`
-		SELECT id, action, video_source, created_at, updated_at
+func (d *Database) GetScenario(ctx context.Context, scenarioID string) (*models.Scenario, error) {
+	row := d.querier(ctx).QueryRowContext(ctx, `
+		SELECT id, action, video_source, last_frame, failed_frames, created_at, updated_at
 		FROM scenarios
 		WHERE id = $1
 	`, scenarioID)
@@ -41,6 +42,8 @@ func (d *Database) GetScenario(scenarioID string) (*models.Scenario, error) {
 		&scenario.ID,
 		&scenario.Action,
 		&scenario.VideoSource,
+		&scenario.LastFrame,
+		pq.Array(&scenario.FailedFrames),
 		&scenario.CreatedAt,
 		&scenario.UpdatedAt,
 	)
@@ -55,13 +58,13 @@ func (d *Database) GetScenario(scenarioID string) (*models.Scenario, error) {
 	return &scenario, nil
 }
 
-// GetInactiveScenarios retrieves stopped scenarios
+// GetInactiveScenarios retrieves stopped, paused and deleted scenarios
 func (d *Database) GetInactiveScenarios(ctx context.Context) ([]models.Scenario, error) {
 	rows, err := d.DB.QueryContext(ctx, `
-		SELECT id, action, video_source, created_at, updated_at
+		SELECT id, action, video_source, last_frame, failed_frames, created_at, updated_at
 		FROM scenarios
-		WHERE action = $1
-	`, models.CommandStop)
+		WHERE action IN ($1, $2, $3)
+	`, models.CommandStop, models.CommandPause, models.CommandDelete)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +77,8 @@ func (d *Database) GetInactiveScenarios(ctx context.Context) ([]models.Scenario,
 			&s.ID,
 			&s.Action,
 			&s.VideoSource,
+			&s.LastFrame,
+			pq.Array(&s.FailedFrames),
 			&s.CreatedAt,
 			&s.UpdatedAt,
 		)
@@ -86,10 +91,10 @@ func (d *Database) GetInactiveScenarios(ctx context.Context) ([]models.Scenario,
 	return scenarios, nil
 }
 
-func (d *Database) ChangeScenarioAction(scenarioID string, newAction models.CommandAction) error {
+func (d *Database) ChangeScenarioAction(ctx context.Context, scenarioID string, newAction models.CommandAction) error {
 	now := time.Now()
 
-	_, err := d.DB.Exec(
+	_, err := d.querier(ctx).ExecContext(ctx,
 		"UPDATE scenarios SET action = $1, updated_at = $2 WHERE id = $3",
 		newAction,
 		now,
@@ -99,12 +104,28 @@ func (d *Database) ChangeScenarioAction(scenarioID string, newAction models.Comm
 	return err
 }
 
-func (d *Database) UpdateScenarioTimestamp(scenarioID string) error {
-	now := time.Now()
+// DeleteScenario removes the scenario row together with its checkpoint
+func (d *Database) DeleteScenario(scenarioID string) error {
+	_, err := d.DB.Exec("DELETE FROM scenarios WHERE id = $1", scenarioID)
+
+	return err
+}
 
+// TouchScenario обновляет время активности сценария, не меняя его прогресс
+func (d *Database) TouchScenario(scenarioID string) error {
+	_, err := d.DB.Exec("UPDATE scenarios SET updated_at = $1 WHERE id = $2", time.Now(), scenarioID)
+
+	return err
+}
+
+// SaveCheckpoint сохраняет прогресс обработки сценария и обновляет время активности.
+// Checkpoint не сдвигается назад: запоздавшее сохранение прежнего запуска пропускается
+func (d *Database) SaveCheckpoint(scenarioID string, lastFrame int, failedFrames []int64) error {
 	_, err := d.DB.Exec(
-		"UPDATE scenarios SET updated_at = $1 WHERE id = $2",
-		now,
+		"UPDATE scenarios SET last_frame = $1, failed_frames = $2, updated_at = $3 WHERE id = $4 AND last_frame <= $1",
+		lastFrame,
+		pq.Array(failedFrames),
+		time.Now(),
 		scenarioID,
 	)
 
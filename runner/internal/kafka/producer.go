@@ -39,6 +39,16 @@ func (p *Producer) Close() error {
 
 // SendHeartbeat отправляет одно сообщение в Kafka
 func (p *Producer) SendHeartbeat(msg models.Heartbeat) error {
+	return p.send(msg.ScenarioID, msg)
+}
+
+// SendResult публикует результаты детекции кадра. Ключ - ID сценария,
+// поэтому результаты одного сценария попадают в одну партицию по порядку
+func (p *Producer) SendResult(msg models.DetectionResult) error {
+	return p.send(msg.ScenarioID, msg)
+}
+
+func (p *Producer) send(key string, msg any) error {
 	payload, err := json.Marshal(msg)
 	if err != nil {
 		return err
@@ -46,7 +56,7 @@ func (p *Producer) SendHeartbeat(msg models.Heartbeat) error {
 
 	kafkaMsg := &sarama.ProducerMessage{
 		Topic: p.topic,
-		Key:   sarama.StringEncoder(msg.ScenarioID),
+		Key:   sarama.StringEncoder(key),
 		Value: sarama.ByteEncoder(payload),
 	}
 
@@ -1,39 +1,70 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
 
-type CommandAction string
+	"github.com/Capitan-Parrot/distributed-video-system/contract"
+)
+
+// Сообщения Kafka описаны в общем контракте оркестратора и раннеров
+type (
+	CommandAction   = contract.CommandAction
+	ScenarioCommand = contract.Command
+	ReplayRange     = contract.ReplayRange
+	FrameFailure    = contract.FrameFailure
+	Heartbeat       = contract.Heartbeat
+	Detection       = contract.Detection
+	ModelInfo       = contract.ModelInfo
+	DetectionResult = contract.DetectionResult
+)
 
 const (
-	CommandStart CommandAction = "start"
-	CommandStop  CommandAction = "stop"
+	CommandStart           = contract.CommandStart
+	CommandStop            = contract.CommandStop
+	CommandReprocessFailed = contract.CommandReprocessFailed
+	CommandPause           = contract.CommandPause
+	CommandResume          = contract.CommandResume
+	CommandReplay          = contract.CommandReplay
+	CommandDelete          = contract.CommandDelete
 )
 
-// Detection представляет структуру одного обнаруженного объекта
-type Detection struct {
-	Class string    `json:"class"`
-	Score float64   `json:"score"`
-	Box   []float64 `json:"box"` // [x1, y1, x2, y2]
+// DetectionResponse ответ сервиса детекции на один кадр
+type DetectionResponse struct {
+	Detections []Detection `json:"detections"`
+	Model      ModelInfo   `json:"model"`
+}
+
+// Frame представляет один кадр сценария с его порядковым индексом
+type Frame struct {
+	Index     int
+	Data      []byte
+	Timestamp time.Time // время получения кадра из живого потока, пустое для записанного видео
+}
+
+// FrameError кадр не удалось получить из источника за все попытки.
+// Источник продолжает со следующего кадра, а этот кадр считается неудачным
+type FrameError struct {
+	Index    int
+	Attempts int
+	Err      error
 }
 
-type ScenarioCommand struct {
-	ScenarioID  string        `json:"scenario_id"`
-	Action      CommandAction `json:"action"`
-	VideoSource string        `json:"video_source"`
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("frame %d: %v", e.Index, e.Err)
 }
 
-type Heartbeat struct {
-	ScenarioID string        `json:"ScenarioID"`
-	Action     CommandAction `json:"Action"`
-	Frame      int64         `json:"Frame"`
-	TimeStamp  time.Time     `json:"TimeStamp"`
+func (e *FrameError) Unwrap() error {
+	return e.Err
 }
 
 // Scenario Структура для сценариев
 type Scenario struct {
-	ID          string        `json:"id"`
-	Action      CommandAction `json:"action"`
-	VideoSource string        `json:"video_source"`
-	CreatedAt   time.Time     `json:"created_at"`
-	UpdatedAt   time.Time     `json:"updated_at"`
+	ID           string        `json:"id"`
+	Action       CommandAction `json:"action"`
+	VideoSource  string        `json:"video_source"`
+	LastFrame    int           `json:"last_frame"`    // последний кадр непрерывно обработанного префикса, -1 если его нет
+	FailedFrames []int64       `json:"failed_frames"` // кадры внутри префикса, которые не удалось обработать
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
 }
@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
+)
+
+// checkpoint отслеживает непрерывно обработанный префикс кадров сценария.
+// Неудачные кадры тоже продвигают префикс, но запоминаются отдельно.
+// Кроме того, копит неудачные и восстановленные кадры до ближайшего heartbeat
+type checkpoint struct {
+	mu        sync.Mutex
+	lastFrame int
+	failed    map[int]struct{}
+	// done кадры за пределами префикса, обработанные раньше предыдущих
+	done map[int]bool
+
+	failures  []models.FrameFailure
+	recovered []int64
+
+	// total число кадров источника, 0 для живого потока
+	total int
+	// recorded кадры, обработанные с момента measuredAt, для расчёта скорости
+	recorded   int
+	measuredAt time.Time
+
+	// replay прогресс повторного прогона: он не сохраняется в базе, а неудачные кадры
+	// не попадают в heartbeat, так как относятся к другой версии результатов
+	replay bool
+	// live прогресс живого потока: его кадры нельзя обработать повторно, поэтому неудачные
+	// кадры не запоминаются и не отправляются в heartbeat, иначе их список растёт без ограничения
+	live bool
+}
+
+func newCheckpoint(scenario *models.Scenario) *checkpoint {
+	c := &checkpoint{
+		lastFrame:  -1,
+		failed:     make(map[int]struct{}),
+		done:       make(map[int]bool),
+		measuredAt: time.Now(),
+	}
+	if scenario == nil {
+		return c
+	}
+
+	c.lastFrame = scenario.LastFrame
+	for _, idx := range scenario.FailedFrames {
+		c.failed[int(idx)] = struct{}{}
+	}
+	return c
+}
+
+// newReplayCheckpoint прогресс повторного прогона диапазона кадров, начинающегося с from
+func newReplayCheckpoint(from int) *checkpoint {
+	return &checkpoint{
+		lastFrame:  from - 1,
+		failed:     make(map[int]struct{}),
+		done:       make(map[int]bool),
+		measuredAt: time.Now(),
+		replay:     true,
+	}
+}
+
+// next возвращает индекс кадра, с которого нужно продолжить обработку
+func (c *checkpoint) next() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastFrame + 1
+}
+
+// record отмечает кадр обработанным, err не nil если кадр обработать не удалось
+func (c *checkpoint) record(frame models.Frame, attempts int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recorded++
+	if err != nil && !c.replay && !c.live {
+		c.failures = append(c.failures, models.FrameFailure{
+			Frame:    int64(frame.Index),
+			Error:    err.Error(),
+			Attempts: attempts,
+		})
+	}
+	if c.mark(frame.Index, err == nil) {
+		c.recovered = append(c.recovered, int64(frame.Index))
+	}
+}
+
+// mark возвращает true, если ранее неудачный кадр наконец удалось обработать
+func (c *checkpoint) mark(idx int, ok bool) bool {
+	if idx <= c.lastFrame {
+		// Повторная обработка кадра внутри префикса
+		_, wasFailed := c.failed[idx]
+		if ok {
+			delete(c.failed, idx)
+		} else if !c.live {
+			c.failed[idx] = struct{}{}
+		}
+		return ok && wasFailed
+	}
+
+	c.done[idx] = ok
+	for {
+		ok, exists := c.done[c.lastFrame+1]
+		if !exists {
+			break
+		}
+		delete(c.done, c.lastFrame+1)
+		c.lastFrame++
+		if !ok && !c.live {
+			c.failed[c.lastFrame] = struct{}{}
+		}
+	}
+	return false
+}
+
+// state возвращает последний кадр префикса и отсортированный список неудачных кадров
+func (c *checkpoint) state() (int, []int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	frames := make([]int64, 0, len(c.failed))
+	for idx := range c.failed {
+		frames = append(frames, int64(idx))
+	}
+	slices.Sort(frames)
+	return c.lastFrame, frames
+}
+
+// pending возвращает кадры, ещё не отправленные в heartbeat
+func (c *checkpoint) pending() ([]models.FrameFailure, []int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.failures), slices.Clone(c.recovered)
+}
+
+// ack убирает из очереди кадры, успешно отправленные в heartbeat
+func (c *checkpoint) ack(failures, recovered int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures = c.failures[failures:]
+	c.recovered = c.recovered[recovered:]
+}
+
+// fps возвращает скорость обработки с прошлого вызова, кадров в секунду
+func (c *checkpoint) fps() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	fps := 0.0
+	if elapsed := now.Sub(c.measuredAt).Seconds(); elapsed > 0 {
+		fps = float64(c.recorded) / elapsed
+	}
+	c.recorded, c.measuredAt = 0, now
+	return fps
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
+	"github.com/samber/lo"
+)
+
+// TestCheckpointPrefix префикс продвигается только по непрерывно обработанным кадрам,
+// кадры, обработанные раньше предыдущих, ждут заполнения пропуска
+func TestCheckpointPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		last   int
+		frames []int
+		want   int
+	}{
+		{name: "in order", last: -1, frames: []int{0, 1, 2}, want: 2},
+		{name: "gap", last: -1, frames: []int{0, 2, 3}, want: 0},
+		{name: "gap filled", last: -1, frames: []int{2, 1, 3, 0}, want: 3},
+		{name: "resume from checkpoint", last: 9, frames: []int{11, 10}, want: 11},
+		{name: "frame inside prefix", last: 9, frames: []int{5}, want: 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCheckpoint(&models.Scenario{LastFrame: tt.last})
+			for _, idx := range tt.frames {
+				c.mark(idx, true)
+			}
+			if c.lastFrame != tt.want {
+				t.Errorf("lastFrame = %d, want %d", c.lastFrame, tt.want)
+			}
+			if c.next() != tt.want+1 {
+				t.Errorf("next() = %d, want %d", c.next(), tt.want+1)
+			}
+		})
+	}
+}
+
+func TestNewCheckpointWithoutScenario(t *testing.T) {
+	if next := newCheckpoint(nil).next(); next != 0 {
+		t.Errorf("next() = %d, want 0", next)
+	}
+}
+
+// TestCheckpointFailedFrames неудачные кадры продвигают префикс и запоминаются,
+// а удачная повторная обработка убирает их и попадает в heartbeat как восстановленные
+func TestCheckpointFailedFrames(t *testing.T) {
+	errDetect := errors.New("detection failed")
+	c := newCheckpoint(&models.Scenario{LastFrame: 4, FailedFrames: []int64{2}})
+
+	c.record(models.Frame{Index: 6}, 5, errDetect)
+	c.record(models.Frame{Index: 5}, 1, nil)
+	// Повторная обработка внутри префикса
+	c.record(models.Frame{Index: 2}, 1, nil)
+	c.record(models.Frame{Index: 3}, 5, errDetect)
+
+	last, failed := c.state()
+	if last != 6 {
+		t.Errorf("last frame = %d, want 6", last)
+	}
+	if !slices.Equal(failed, []int64{3, 6}) {
+		t.Errorf("failed frames = %v, want [3 6]", failed)
+	}
+
+	failures, recovered := c.pending()
+	if got := lo.Map(failures, func(f models.FrameFailure, _ int) int64 { return f.Frame }); !slices.Equal(got, []int64{6, 3}) {
+		t.Errorf("pending failures = %v, want [6 3]", got)
+	}
+	if !slices.Equal(recovered, []int64{2}) {
+		t.Errorf("recovered frames = %v, want [2]", recovered)
+	}
+
+	c.ack(1, 1)
+	failures, recovered = c.pending()
+	if len(failures) != 1 || failures[0].Frame != 3 || len(recovered) != 0 {
+		t.Errorf("after ack pending = %v, %v, want only frame 3 failure", failures, recovered)
+	}
+}
+
+// TestReplayCheckpoint повторный прогон начинается с первого кадра диапазона
+// и не отправляет неудачные кадры в heartbeat: они относятся к другой версии результатов
+func TestReplayCheckpoint(t *testing.T) {
+	c := newReplayCheckpoint(10)
+	if next := c.next(); next != 10 {
+		t.Errorf("next() = %d, want 10", next)
+	}
+
+	c.record(models.Frame{Index: 10}, 5, errors.New("detection failed"))
+	c.record(models.Frame{Index: 11}, 1, nil)
+	if next := c.next(); next != 12 {
+		t.Errorf("next() = %d, want 12", next)
+	}
+	if failures, _ := c.pending(); len(failures) != 0 {
+		t.Errorf("pending failures = %v, want none", failures)
+	}
+}
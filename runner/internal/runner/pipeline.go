@@ -0,0 +1,249 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
+)
+
+// Options настройки параллельной обработки кадров
+type Options struct {
+	// FramesInFlight максимальное число кадров одного сценария, находящихся в обработке
+	FramesInFlight int
+	// MaxInFlightFrames максимальное число одновременных запросов к детекции на весь раннер
+	MaxInFlightFrames int
+	// StreamSampleFPS частота, с которой берутся кадры живых потоков
+	StreamSampleFPS float64
+}
+
+// retryDelay начальная пауза между повторами детекции, сохранения и публикации результатов кадра,
+// с каждой попыткой она удваивается
+const retryDelay = 200 * time.Millisecond
+
+// frameSource источник кадров сценария: записанное видео в s3 или живой поток
+type frameSource interface {
+	Next(ctx context.Context) (models.Frame, error)
+	Close()
+}
+
+// pipelineJob кадр, проходящий через стадии конвейера
+type pipelineJob struct {
+	seq      int
+	frame    models.Frame
+	response models.DetectionResponse
+	attempts int
+	err      error
+}
+
+// runPipeline прогоняет кадры через стадии fetch → detect → persist.
+// Детекция выполняется параллельно для не более чем FramesInFlight кадров сценария,
+// а результаты сохраняются строго в порядке получения кадров.
+// persisted вызывается для каждого обработанного кадра с числом попыток последней стадии,
+// err не nil, если кадр обработать не удалось
+func (r *Runner) runPipeline(ctx context.Context, cmd models.ScenarioCommand, frames frameSource, persisted func(frame models.Frame, attempts int, err error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	window := make(chan struct{}, r.opts.FramesInFlight)
+	fetched := make(chan pipelineJob)
+	detected := make(chan pipelineJob)
+
+	// fetch: читаем кадры, пока есть свободное место в окне сценария
+	var fetchErr error
+	fetchDone := make(chan struct{})
+	go func() {
+		defer close(fetchDone)
+		defer close(fetched)
+
+		for seq := 0; ; seq++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			job := pipelineJob{seq: seq}
+			var frameErr *models.FrameError
+			job.frame, job.err = frames.Next(ctx)
+			if errors.As(job.err, &frameErr) {
+				// Кадр недоступен, но следующие кадры источник отдаст: кадр проходит конвейер неудачным
+				job.frame, job.attempts = models.Frame{Index: frameErr.Index}, frameErr.Attempts
+			} else if job.err != nil {
+				if !errors.Is(job.err, io.EOF) && ctx.Err() == nil {
+					fetchErr = job.err
+				}
+				return
+			}
+
+			select {
+			case fetched <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// detect: отправляем кадры в сервис детекции
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.FramesInFlight; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range fetched {
+				if job.err == nil {
+					job.response, job.attempts, job.err = r.detectWithRetries(ctx, cmd, job.frame)
+				}
+				select {
+				case detected <- job:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(detected)
+	}()
+
+	// persist: сохраняем результаты по порядку, чтобы возобновление не пропускало кадры
+	pending := make(map[int]pipelineJob)
+	next := 0
+	for job := range detected {
+		pending[job.seq] = job
+		for {
+			job, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			err := job.err
+			if err == nil {
+				job.attempts, err = r.persistWithRetries(ctx, cmd, job.frame, job.response)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+
+			persisted(job.frame, job.attempts, err)
+			<-window
+		}
+	}
+
+	cancel()
+	<-fetchDone
+	return fetchErr
+}
+
+func (r *Runner) detectWithRetries(ctx context.Context, cmd models.ScenarioCommand, frame models.Frame) (models.DetectionResponse, int, error) {
+	var lastErr error
+	delay := retryDelay
+	for attempt := 1; attempt <= retries; attempt++ {
+		// Ограничиваем общее число запросов к детекции со всех сценариев раннера
+		select {
+		case r.detectSlots <- struct{}{}:
+		case <-ctx.Done():
+			return models.DetectionResponse{}, attempt - 1, ctx.Err()
+		}
+		response, err := r.detectionClient.SendFrame(frame.Data, cmd.ScenarioID)
+		<-r.detectSlots
+
+		if err == nil {
+			return response, attempt, nil
+		}
+		log.Printf("Runner %s: detection error: %v", cmd.ScenarioID, err)
+		lastErr = err
+
+		// Сервис детекции может быть перегружен, повтор без паузы только усилит нагрузку
+		if attempt < retries && !waitRetry(ctx, &delay) {
+			return models.DetectionResponse{}, attempt, ctx.Err()
+		}
+	}
+
+	return models.DetectionResponse{}, retries, lastErr
+}
+
+// persistWithRetries сохраняет результаты кадра в S3 и публикует их в топик результатов.
+// Кадр считается обработанным после записи в S3: ошибка публикации не делает его неудачным,
+// публикация повторяется отдельно и при неудаче только логируется
+func (r *Runner) persistWithRetries(ctx context.Context, cmd models.ScenarioCommand, frame models.Frame, response models.DetectionResponse) (int, error) {
+	var lastErr error
+	delay := retryDelay
+	for attempt := 1; attempt <= retries; attempt++ {
+		if ctx.Err() != nil {
+			return attempt - 1, ctx.Err()
+		}
+
+		err := r.s3Client.SaveDetectionResults(ctx, cmd.ScenarioID, cmd.ResultVersion(), frame.Index, response.Detections)
+		if err != nil {
+			log.Printf("Runner %s: save detection error: %v", cmd.ScenarioID, err)
+			lastErr = err
+			if attempt < retries && !waitRetry(ctx, &delay) {
+				return attempt, ctx.Err()
+			}
+			continue
+		}
+
+		r.publishWithRetries(ctx, cmd, frame, response)
+		return attempt, nil
+	}
+
+	return retries, lastErr
+}
+
+// publishWithRetries публикует результаты кадра с повторами. Результаты уже сохранены в S3,
+// поэтому после исчерпания попыток кадр остаётся обработанным, а пропуск в топике логируется
+func (r *Runner) publishWithRetries(ctx context.Context, cmd models.ScenarioCommand, frame models.Frame, response models.DetectionResponse) {
+	delay := retryDelay
+	for attempt := 1; attempt <= retries; attempt++ {
+		err := r.publishResult(cmd, frame, response)
+		if err == nil {
+			return
+		}
+		log.Printf("Runner %s: publish detection error for frame %d (attempt %d): %v", cmd.ScenarioID, frame.Index, attempt, err)
+
+		if attempt < retries && !waitRetry(ctx, &delay) {
+			return
+		}
+	}
+
+	log.Printf("Runner %s: frame %d results saved but not published to results topic", cmd.ScenarioID, frame.Index)
+}
+
+func (r *Runner) publishResult(cmd models.ScenarioCommand, frame models.Frame, response models.DetectionResponse) error {
+	if r.results == nil {
+		return nil
+	}
+
+	result := models.DetectionResult{
+		ScenarioID:  cmd.ScenarioID,
+		Frame:       frame.Index,
+		ProcessedAt: time.Now().UTC(),
+		Model:       response.Model,
+		Detections:  response.Detections,
+		// Потребители отличают повторный прогон от исходных результатов
+		ResultVersion: cmd.ResultVersion(),
+	}
+	if !frame.Timestamp.IsZero() {
+		result.FrameTimestamp = &frame.Timestamp
+	}
+	return r.results.SendResult(result)
+}
+
+// waitRetry ждёт delay перед следующей попыткой и удваивает его. Возвращает false, если ctx отменён
+func waitRetry(ctx context.Context, delay *time.Duration) bool {
+	select {
+	case <-time.After(*delay):
+		*delay *= 2
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -3,6 +3,7 @@ package runner
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
 	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/s3"
 	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/services/detection"
+	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/stream"
 	"github.com/samber/lo"
 )
 
@@ -20,27 +22,57 @@ const (
 	retries                 = 5
 	heartbeatInterval       = 5 * time.Second
 	checkStopEventsInterval = 10 * time.Second
+	// deleteWaitTimeout сколько ждать выхода из обработки удалённого сценария за одну проверку
+	deleteWaitTimeout = 5 * time.Second
+	// commandLedgerRetention сколько хранятся ID обработанных команд, дольше хранения топика команд
+	commandLedgerRetention = 14 * 24 * time.Hour
+	// framePrefetch ограничивает число кадров, скачанных заранее для одного сценария
+	framePrefetch = 8
 )
 
+// errPaused причина отмены контекста сценария, поставленного на паузу
+var errPaused = errors.New("scenario paused")
+
 type Runner struct {
 	db              *database.Database
 	s3Client        *s3.Client
 	detectionClient *detection.Client
 	consumer        *kafka.Consumer
 	producer        *kafka.Producer
+	// results публикует результаты кадров, nil если топик результатов не настроен
+	results *kafka.Producer
+	opts    Options
 
-	activeRunners map[string]context.CancelFunc
+	// detectSlots ограничивает число одновременных запросов к детекции со всего раннера
+	detectSlots   chan struct{}
+	activeRunners map[string]*scenarioRun
 	mu            sync.Mutex
 }
 
-func New(db *database.Database, s3Client *s3.Client, detectionClient *detection.Client, consumer *kafka.Consumer, producer *kafka.Producer) *Runner {
+// scenarioRun запуск сценария на этом раннере. Запись удаляется из activeRunners,
+// только когда обработка завершилась и checkpoint сохранён
+type scenarioRun struct {
+	cancel context.CancelCauseFunc
+	// cancelled запуск уже отменён и дорабатывает, защищено Runner.mu
+	cancelled bool
+	// done закрывается после выхода из обработки
+	done chan struct{}
+}
+
+func New(db *database.Database, s3Client *s3.Client, detectionClient *detection.Client, consumer *kafka.Consumer, producer, results *kafka.Producer, opts Options) *Runner {
+	opts.FramesInFlight = max(opts.FramesInFlight, 1)
+	opts.MaxInFlightFrames = max(opts.MaxInFlightFrames, 1)
+
 	return &Runner{
 		db:              db,
 		s3Client:        s3Client,
 		detectionClient: detectionClient,
 		consumer:        consumer,
 		producer:        producer,
-		activeRunners:   make(map[string]context.CancelFunc),
+		results:         results,
+		opts:            opts,
+		detectSlots:     make(chan struct{}, opts.MaxInFlightFrames),
+		activeRunners:   make(map[string]*scenarioRun),
 	}
 }
 
@@ -62,10 +94,12 @@ func (r *Runner) ListenAndRun(ctx context.Context) {
 
 			var processErr error
 			switch cmd.Action {
-			case models.CommandStart:
+			case models.CommandStart, models.CommandResume, models.CommandReprocessFailed, models.CommandReplay:
 				processErr = r.Start(ctx, cmd)
-			case models.CommandStop:
-				processErr = r.RegisterStopEvent(cmd.ScenarioID)
+			case models.CommandStop, models.CommandPause:
+				processErr = r.RegisterStopEvent(ctx, cmd)
+			case models.CommandDelete:
+				processErr = r.RegisterDeleteEvent(ctx, cmd)
 			default:
 				log.Printf("Unknown command: %s", cmd.Action)
 			}
@@ -82,59 +116,102 @@ func (r *Runner) ListenAndRun(ctx context.Context) {
 	}
 }
 
+// once применяет команду к базе раннеров в одной транзакции с записью её ID в журнал обработанных команд.
+// Повторно доставленная команда пропускается без вызова apply
+func (r *Runner) once(ctx context.Context, cmd models.ScenarioCommand, apply func(ctx context.Context) error) error {
+	applied := false
+	err := r.db.InTx(ctx, func(ctx context.Context) error {
+		// ID строки outbox несут команды всех версий оркестратора, без него повтор не отличить от новой команды
+		if cmd.ID != "" {
+			claimed, err := r.db.ClaimCommand(ctx, cmd)
+			if err != nil || !claimed {
+				return err
+			}
+		}
+
+		applied = true
+		return apply(ctx)
+	})
+	if err == nil && !applied {
+		log.Printf("Runner %s: command %s %s already processed, skipping", cmd.ScenarioID, cmd.ID, cmd.Action)
+	}
+
+	return err
+}
+
 func (r *Runner) Start(ctx context.Context, cmd models.ScenarioCommand) error {
-	existScenario, err := r.db.GetScenario(cmd.ScenarioID)
-	if err != nil {
-		log.Printf("Database error: %v", err)
+	if err := r.awaitPreviousRun(ctx, cmd.ScenarioID); err != nil {
 		return err
 	}
-	if existScenario != nil {
-		if existScenario.Action == models.CommandStart && time.Now().Sub(existScenario.UpdatedAt) < heartbeatInterval*3 {
-			log.Printf("Runner for %s already running", cmd.ScenarioID)
+
+	run := false
+	if err := r.once(ctx, cmd, func(ctx context.Context) error {
+		existScenario, err := r.db.GetScenario(ctx, cmd.ScenarioID)
+		if err != nil {
+			log.Printf("Database error: %v", err)
 			return err
 		}
-	}
+		if existScenario != nil {
+			if existScenario.Action == models.CommandStart && time.Now().Sub(existScenario.UpdatedAt) < heartbeatInterval*3 {
+				log.Printf("Runner for %s already running", cmd.ScenarioID)
+				return nil
+			}
+		}
 
-	if err := r.db.CreateScenario(&models.Scenario{
-		ID:          cmd.ScenarioID,
-		Action:      cmd.Action,
-		VideoSource: cmd.VideoSource,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}); err != nil {
-		log.Printf("Database error: %v", err)
+		if err := r.db.CreateScenario(ctx, &models.Scenario{
+			ID:          cmd.ScenarioID,
+			Action:      models.CommandStart,
+			VideoSource: cmd.VideoSource,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}); err != nil {
+			log.Printf("Database error: %v", err)
+			return err
+		}
+
+		run = true
+		return nil
+	}); err != nil || !run {
 		return err
 	}
+	r.mu.Lock()
+	if _, ok := r.activeRunners[cmd.ScenarioID]; ok {
+		r.mu.Unlock()
+		log.Printf("Runner for %s already running", cmd.ScenarioID)
+		return nil
+	}
+	childCtx, cancel := context.WithCancelCause(ctx)
+	current := &scenarioRun{cancel: cancel, done: make(chan struct{})}
+	r.activeRunners[cmd.ScenarioID] = current
+	if len(r.activeRunners) >= maxScenarios {
+		log.Printf("Runner for %s max scenarios reached", cmd.ScenarioID)
+		r.consumer.Pause()
+	}
+	r.mu.Unlock()
 	log.Printf("Runner for %s created", cmd.ScenarioID)
 
+	// Команда уже записана в журнал и не будет доставлена повторно,
+	// оркестратор узнает о запуске и из heartbeat с прогрессом
 	if err := r.producer.SendHeartbeat(models.Heartbeat{
 		ScenarioID: cmd.ScenarioID,
 		Action:     models.CommandStart,
 		TimeStamp:  time.Now().UTC(),
 	}); err != nil {
 		log.Printf("Runner %s error sending live heartbeat: %v", cmd.ScenarioID, err)
-		return err
-	}
-
-	r.mu.Lock()
-	childCtx, cancel := context.WithCancel(ctx)
-	r.activeRunners[cmd.ScenarioID] = cancel
-	r.mu.Unlock()
-
-	if len(r.activeRunners) >= maxScenarios {
-		log.Printf("Runner for %s max scenarios reached", cmd.ScenarioID)
-		r.consumer.Pause()
 	}
 
 	go func() {
 		defer func() {
-			if len(r.activeRunners) == maxScenarios {
-				r.consumer.Resume(ctx)
-			}
-
 			r.mu.Lock()
-			delete(r.activeRunners, cmd.ScenarioID)
+			// Запись могла смениться только новым запуском, чужую запись не удаляем
+			if r.activeRunners[cmd.ScenarioID] == current {
+				if len(r.activeRunners) == maxScenarios {
+					r.consumer.Resume(ctx)
+				}
+				delete(r.activeRunners, cmd.ScenarioID)
+			}
 			r.mu.Unlock()
+			close(current.done)
 
 			log.Printf("Runner %s finished", cmd.ScenarioID)
 		}()
@@ -147,103 +224,252 @@ func (r *Runner) Start(ctx context.Context, cmd models.ScenarioCommand) error {
 	return nil
 }
 
-// processScenario скачивает кадры, отправляет их на детекцию и сохраняет в s3
-func (r *Runner) processScenario(ctx context.Context, cmd models.ScenarioCommand) error {
-	log.Printf("Runner %s: downloading frames from %s", cmd.ScenarioID, cmd.VideoSource)
+// awaitPreviousRun ждёт выхода прежнего запуска сценария на этом раннере, если тот отменён или завершается.
+// Он ещё сохраняет checkpoint, и новый запуск должен продолжить с этого checkpoint, а не с более раннего.
+// Работающий запуск не ждём: повторная команда запуска будет пропущена
+func (r *Runner) awaitPreviousRun(ctx context.Context, scenarioID string) error {
+	r.mu.Lock()
+	previous, ok := r.activeRunners[scenarioID]
+	cancelled := ok && previous.cancelled
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
 
-	frames, err := r.s3Client.DownloadFilesFromURL(ctx, cmd.VideoSource)
+	if !cancelled {
+		// Завершающийся сценарий уже отмечен остановленным, а отменяемый - приостановленным или остановленным
+		scenario, err := r.db.GetScenario(ctx, scenarioID)
+		if err != nil {
+			return err
+		}
+		if scenario != nil && scenario.Action == models.CommandStart {
+			return nil
+		}
+	}
+
+	log.Printf("Runner %s: waiting for previous run to finish", scenarioID)
+	select {
+	case <-previous.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// processScenario получает кадры, отправляет их на детекцию и сохраняет в s3.
+// Обработка продолжается с сохранённого в базе checkpoint
+func (r *Runner) processScenario(ctx context.Context, cmd models.ScenarioCommand) error {
+	scenario, err := r.db.GetScenario(ctx, cmd.ScenarioID)
 	if err != nil {
 		return err
 	}
+	progress := newCheckpoint(scenario)
+	if cmd.Action == models.CommandReplay {
+		if cmd.Replay == nil {
+			return errors.New("replay command without frame range")
+		}
+		// Повторный прогон не должен сдвигать checkpoint основной обработки
+		progress = newReplayCheckpoint(int(cmd.Replay.FromFrame))
+	}
+	if stream.IsStreamURL(cmd.VideoSource) {
+		progress.live = true
+		// Неудачные кадры, сохранённые прежними версиями раннера, тоже не нужны
+		clear(progress.failed)
+	}
 
-	processedFramesCount, err := r.s3Client.CountFilesInFolder(ctx, cmd.ScenarioID)
+	log.Printf("Runner %s: reading frames from %s", cmd.ScenarioID, cmd.VideoSource)
+	frames, err := r.openFrameSource(ctx, cmd, progress.next())
 	if err != nil {
 		return err
 	}
+	defer frames.Close()
+	if sized, ok := frames.(interface{ Len() int }); ok {
+		// Живой поток бесконечен, число кадров известно только у записанного видео
+		progress.total = sized.Len()
+	}
 
-	timer := time.NewTicker(heartbeatInterval)
-	log.Printf("Runner %s: started processing from %d frame", cmd.ScenarioID, processedFramesCount)
-	for idx := processedFramesCount; idx < len(frames); idx++ {
-		if err := r.processFrameWithRetries(ctx, cmd, frames[idx], idx); err != nil {
-			return err
-		}
+	log.Printf("Runner %s: started processing from %d frame", cmd.ScenarioID, progress.next())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.runPipeline(ctx, cmd, frames, func(frame models.Frame, attempts int, err error) {
+			if err != nil {
+				log.Printf("Runner %s: failed to process frame %d: %v", cmd.ScenarioID, frame.Index, err)
+			}
+			progress.record(frame, attempts, err)
+		})
+	}()
 
+	// Heartbeat отправляется по таймеру, а не по кадрам, чтобы живой поток
+	// без новых кадров не считался зависшим
+	timer := time.NewTicker(heartbeatInterval)
+	defer timer.Stop()
+	for {
 		select {
-		case <-ctx.Done():
-			return nil
 		case <-timer.C:
-			if err := r.db.UpdateScenarioTimestamp(cmd.ScenarioID); err != nil {
-				log.Printf("Runner %s error updating scenario timestamp: %v", cmd.ScenarioID, err)
+			r.saveCheckpoint(cmd.ScenarioID, progress)
+			lastFrame, _ := progress.state()
+			r.sendProgress(cmd.ScenarioID, models.CommandStart, int64(lastFrame), progress)
+		case err := <-done:
+			r.saveCheckpoint(cmd.ScenarioID, progress)
+			lastFrame, failed := progress.state()
+
+			if err == nil && errors.Is(context.Cause(ctx), errPaused) {
+				// Checkpoint уже сохранён, resume продолжит со следующего кадра
+				r.sendProgress(cmd.ScenarioID, models.CommandPause, int64(lastFrame+1), progress)
+				log.Printf("Runner %s: paused before %d frame", cmd.ScenarioID, lastFrame+1)
+				return nil
 			}
 
-			if err := r.producer.SendHeartbeat(models.Heartbeat{
-				ScenarioID: cmd.ScenarioID,
-				Action:     models.CommandStart,
-				Frame:      int64(idx),
-				TimeStamp:  time.Now().UTC(),
-			}); err != nil {
-				log.Printf("Runner %s error sending live heartbeat: %v", cmd.ScenarioID, err)
+			if err != nil || ctx.Err() != nil {
+				// Не теряем накопленные неудачные кадры при остановке
+				if failures, recovered := progress.pending(); len(failures) > 0 || len(recovered) > 0 {
+					r.sendProgress(cmd.ScenarioID, models.CommandStart, int64(lastFrame), progress)
+				}
+				if err == nil {
+					log.Printf("Runner %s: received stop", cmd.ScenarioID)
+				}
+				return err
 			}
-		default:
+
+			// Завершённый сценарий не должен считаться работающим: иначе reprocess_failed или replay,
+			// пришедшие сразу после завершения, будут пропущены как дубликат запуска
+			if err := r.db.ChangeScenarioAction(context.WithoutCancel(ctx), cmd.ScenarioID, models.CommandStop); err != nil {
+				log.Printf("Runner %s error marking scenario finished: %v", cmd.ScenarioID, err)
+			}
+			r.sendProgress(cmd.ScenarioID, models.CommandStop, int64(lastFrame+1), progress)
+			log.Printf("Runner %s: finished sending %d frames, %d failed", cmd.ScenarioID, lastFrame+1, len(failed))
+			return nil
 		}
 	}
+}
 
+// openFrameSource выбирает источник кадров по video_source сценария
+func (r *Runner) openFrameSource(ctx context.Context, cmd models.ScenarioCommand, start int) (frameSource, error) {
+	switch cmd.Action {
+	case models.CommandReprocessFailed:
+		return r.s3Client.NewSelectedFrameIterator(ctx, cmd.VideoSource, cmd.Frames, framePrefetch)
+	case models.CommandReplay:
+		return r.s3Client.NewRangeFrameIterator(ctx, cmd.VideoSource, cmd.Replay.FromFrame, cmd.Replay.ToFrame, framePrefetch)
+	}
+
+	if stream.IsStreamURL(cmd.VideoSource) {
+		return stream.Open(ctx, cmd.VideoSource, start, r.opts.StreamSampleFPS)
+	}
+
+	return r.s3Client.NewFrameIterator(ctx, cmd.VideoSource, start, framePrefetch)
+}
+
+func (r *Runner) saveCheckpoint(scenarioID string, progress *checkpoint) {
+	if progress.replay {
+		// Обновляем только время активности, чтобы повторная команда не запустила второй экземпляр
+		if err := r.db.TouchScenario(scenarioID); err != nil {
+			log.Printf("Runner %s error updating activity: %v", scenarioID, err)
+		}
+		return
+	}
+
+	lastFrame, failed := progress.state()
+	if err := r.db.SaveCheckpoint(scenarioID, lastFrame, failed); err != nil {
+		log.Printf("Runner %s error saving checkpoint: %v", scenarioID, err)
+	}
+}
+
+// sendProgress отправляет heartbeat вместе с накопленными неудачными и восстановленными кадрами,
+// числом кадров источника и скоростью обработки
+func (r *Runner) sendProgress(scenarioID string, action models.CommandAction, frame int64, progress *checkpoint) {
+	failures, recovered := progress.pending()
 	if err := r.producer.SendHeartbeat(models.Heartbeat{
-		ScenarioID: cmd.ScenarioID,
-		Action:     models.CommandStop,
-		Frame:      int64(len(frames)),
-		TimeStamp:  time.Now().UTC(),
+		ScenarioID:      scenarioID,
+		Action:          action,
+		Frame:           frame,
+		TimeStamp:       time.Now().UTC(),
+		FailedFrames:    failures,
+		RecoveredFrames: recovered,
+		TotalFrames:     int64(progress.total),
+		FPS:             progress.fps(),
 	}); err != nil {
-		log.Printf("Runner %s error sending live heartbeat: %v", cmd.ScenarioID, err)
+		log.Printf("Runner %s error sending live heartbeat: %v", scenarioID, err)
+		return
 	}
-	log.Printf("Runner %s: finished sending %d frames", cmd.ScenarioID, len(frames))
-	return nil
+	progress.ack(len(failures), len(recovered))
 }
 
-func (r *Runner) processFrameWithRetries(ctx context.Context, cmd models.ScenarioCommand, frame []byte, idx int) error {
-	success := false
+// RegisterStopEvent отмечает сценарий остановленным или приостановленным.
+// Раннер, который его обрабатывает, заметит это в ProcessStopEvent
+func (r *Runner) RegisterStopEvent(ctx context.Context, cmd models.ScenarioCommand) error {
+	err := r.once(ctx, cmd, func(ctx context.Context) error {
+		return r.db.ChangeScenarioAction(ctx, cmd.ScenarioID, cmd.Action)
+	})
+	if err != nil {
+		log.Printf("Runner %s error stopping scenario: %v", cmd.ScenarioID, err)
+		return err
+	}
 
-	for attempt := 0; !success && attempt < retries; attempt++ {
-		if success {
-			break
-		}
+	return nil
+}
 
-		select {
-		case <-ctx.Done():
-			log.Printf("Runner %s: received stop", cmd.ScenarioID)
+// RegisterDeleteEvent отмечает сценарий удалённым. Если ни один раннер его не обрабатывал,
+// удаление подтверждается сразу, иначе - в ProcessStopEvent после остановки
+func (r *Runner) RegisterDeleteEvent(ctx context.Context, cmd models.ScenarioCommand) error {
+	unknown := false
+	err := r.once(ctx, cmd, func(ctx context.Context) error {
+		scenario, err := r.db.GetScenario(ctx, cmd.ScenarioID)
+		if err != nil {
+			return err
+		}
+		if scenario == nil {
+			unknown = true
 			return nil
-		default:
-			detections, err := r.detectionClient.SendFrame(frame, cmd.ScenarioID)
-			if err != nil {
-				log.Printf("Runner %s: detection error: %v", cmd.ScenarioID, err)
-				continue
-			}
-
-			if err := r.s3Client.SaveDetectionResults(ctx, cmd.ScenarioID, idx, detections); err != nil {
-				log.Printf("Runner %s: save detection error: %v", cmd.ScenarioID, err)
-				continue
-			}
-
-			success = true
 		}
-	}
 
-	if !success {
-		log.Printf("Runner %s: failed to process frame %d", cmd.ScenarioID, idx)
+		return r.db.ChangeScenarioAction(ctx, cmd.ScenarioID, models.CommandDelete)
+	})
+	if err != nil {
+		log.Printf("Runner %s error deleting scenario: %v", cmd.ScenarioID, err)
+		return err
+	}
+	if unknown {
+		// Без подтверждения оркестратор удалит данные по истечении ожидания
+		r.sendDeleted(cmd.ScenarioID)
 	}
 
 	return nil
 }
 
-func (r *Runner) RegisterStopEvent(scenarioID string) error {
-	if err := r.db.ChangeScenarioAction(scenarioID, models.CommandStop); err != nil {
-		log.Printf("Runner %s error stopping scenario: %v", scenarioID, err)
+// sendDeleted подтверждает оркестратору, что раннеры больше не обрабатывают сценарий
+func (r *Runner) sendDeleted(scenarioID string) error {
+	if err := r.producer.SendHeartbeat(models.Heartbeat{
+		ScenarioID: scenarioID,
+		Action:     models.CommandDelete,
+		TimeStamp:  time.Now().UTC(),
+	}); err != nil {
+		log.Printf("Runner %s error sending delete heartbeat: %v", scenarioID, err)
 		return err
 	}
 
 	return nil
 }
 
+// PruneCommandLedger раз в час удаляет из журнала команды, которые Kafka уже не доставит повторно
+func (r *Runner) PruneCommandLedger(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := r.db.PruneProcessedCommands(ctx, time.Now().Add(-commandLedgerRetention))
+			if err != nil {
+				log.Printf("Runner: error pruning processed commands: %v", err)
+			} else if pruned > 0 {
+				log.Printf("Runner: pruned %d processed commands", pruned)
+			}
+		}
+	}
+}
+
 func (r *Runner) ProcessStopEvent(ctx context.Context) {
 	timer := time.NewTicker(checkStopEventsInterval)
 	for {
@@ -254,7 +480,23 @@ func (r *Runner) ProcessStopEvent(ctx context.Context) {
 				log.Printf("Error getting inactive scenario status: %v", err)
 			}
 
-			scenarioIDs := lo.Map(scenarios, func(s models.Scenario, _ int) string {
+			deleted, scenarios := lo.FilterReject(scenarios, func(s models.Scenario, _ int) bool {
+				return s.Action == models.CommandDelete
+			})
+			for _, scenario := range deleted {
+				r.processDeleted(ctx, scenario)
+			}
+
+			paused, stopped := lo.FilterReject(scenarios, func(s models.Scenario, _ int) bool {
+				return s.Action == models.CommandPause
+			})
+
+			// Heartbeat о паузе отправит сам сценарий, когда сохранит checkpoint
+			for _, scenario := range paused {
+				r.cancelScenario(ctx, scenario.ID, errPaused)
+			}
+
+			scenarioIDs := lo.Map(stopped, func(s models.Scenario, _ int) string {
 				return s.ID
 			})
 
@@ -275,19 +517,58 @@ func (r *Runner) ProcessStopEvent(ctx context.Context) {
 	}
 }
 
+// processDeleted останавливает удалённый сценарий, если он обрабатывается этим раннером,
+// и удаляет его запись. Запись без обновлений дольше трёх heartbeat не обрабатывается никем,
+// её удаляет любой раннер. Удаление подтверждается только после выхода из обработки:
+// до этого сценарий ещё может записать кадры и checkpoint
+func (r *Runner) processDeleted(ctx context.Context, scenario models.Scenario) {
+	r.mu.Lock()
+	run, ok := r.activeRunners[scenario.ID]
+	r.mu.Unlock()
+	if !ok && time.Since(scenario.UpdatedAt) < heartbeatInterval*3 {
+		return
+	}
+
+	if ok {
+		r.Stop(ctx, scenario.ID)
+		// Не задерживаем остальные сценарии надолго, удаление повторится на следующей проверке
+		select {
+		case <-run.done:
+		case <-time.After(deleteWaitTimeout):
+			log.Printf("Runner %s: still finishing, deletion postponed", scenario.ID)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := r.db.DeleteScenario(scenario.ID); err != nil {
+		log.Printf("Runner %s error deleting scenario: %v", scenario.ID, err)
+		return
+	}
+	if err := r.sendDeleted(scenario.ID); err == nil {
+		log.Printf("Runner %s deleted", scenario.ID)
+	}
+}
+
 func (r *Runner) Stop(ctx context.Context, scenarioID string) bool {
+	return r.cancelScenario(ctx, scenarioID, nil)
+}
+
+// cancelScenario прерывает обработку сценария на этом раннере. Слот освобождается,
+// когда обработка сохранит checkpoint и завершится. Возвращает false, если сценарий
+// не обрабатывается или уже отменён
+func (r *Runner) cancelScenario(ctx context.Context, scenarioID string, cause error) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if cancel, ok := r.activeRunners[scenarioID]; ok {
-		cancel()
-		if len(r.activeRunners) == maxScenarios {
-			r.consumer.Resume(ctx)
-		}
-		log.Printf("Runner %s stopped", scenarioID)
-		delete(r.activeRunners, scenarioID)
-		return true
+	run, ok := r.activeRunners[scenarioID]
+	if !ok || run.cancelled {
+		return false
 	}
 
-	return false
+	run.cancelled = true
+	run.cancel(cause)
+	log.Printf("Runner %s stopped", scenarioID)
+	return true
 }
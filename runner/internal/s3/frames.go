@@ -0,0 +1,263 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// downloadRetries сколько раз скачивается кадр, прежде чем он считается неудачным
+	downloadRetries = 3
+	// downloadRetryDelay начальная пауза между попытками скачать кадр
+	downloadRetryDelay = 200 * time.Millisecond
+)
+
+// FrameIterator лениво скачивает кадры сценария в порядке ключей объектов,
+// удерживая в памяти не больше prefetch кадров одновременно
+type FrameIterator struct {
+	keys   []string
+	order  []int
+	frames chan frameResult
+	cancel context.CancelFunc
+}
+
+type frameResult struct {
+	frame models.Frame
+	err   error
+}
+
+// NewFrameIterator получает список кадров по адресу вида bucket/prefix и запускает
+// фоновую загрузку, начиная с кадра start. Сами кадры в память заранее не читаются
+func (c *Client) NewFrameIterator(ctx context.Context, fileURL string, start, prefetch int) (*FrameIterator, error) {
+	return c.newFrameIterator(ctx, fileURL, prefetch, func(keys []string) []int {
+		var order []int
+		for idx := start; idx < len(keys); idx++ {
+			order = append(order, idx)
+		}
+		return order
+	})
+}
+
+// NewRangeFrameIterator загружает кадры с from по to включительно, to < 0 - до последнего кадра
+func (c *Client) NewRangeFrameIterator(ctx context.Context, fileURL string, from, to int64, prefetch int) (*FrameIterator, error) {
+	if from < 0 {
+		return nil, fmt.Errorf("invalid frame range: from_frame %d is negative", from)
+	}
+
+	return c.newFrameIterator(ctx, fileURL, prefetch, func(keys []string) []int {
+		last := int64(len(keys)) - 1
+		if to >= 0 {
+			last = min(last, to)
+		}
+
+		var order []int
+		for idx := from; idx <= last; idx++ {
+			order = append(order, int(idx))
+		}
+		return order
+	})
+}
+
+// NewSelectedFrameIterator загружает только кадры с указанными индексами в порядке их перечисления.
+// Индексы за пределами сценария пропускаются
+func (c *Client) NewSelectedFrameIterator(ctx context.Context, fileURL string, indexes []int64, prefetch int) (*FrameIterator, error) {
+	return c.newFrameIterator(ctx, fileURL, prefetch, func(keys []string) []int {
+		var order []int
+		for _, idx := range indexes {
+			if idx >= 0 && idx < int64(len(keys)) {
+				order = append(order, int(idx))
+			}
+		}
+		return order
+	})
+}
+
+func (c *Client) newFrameIterator(ctx context.Context, fileURL string, prefetch int, order func(keys []string) []int) (*FrameIterator, error) {
+	bucket, folder, err := parseFolderURL(fileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := c.listFrameKeys(ctx, bucket, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefetch < 1 {
+		prefetch = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	it := &FrameIterator{
+		keys:   keys,
+		order:  order(keys),
+		frames: make(chan frameResult, prefetch),
+		cancel: cancel,
+	}
+
+	go it.fetch(ctx, c, bucket)
+
+	return it, nil
+}
+
+// Len возвращает общее количество кадров в сценарии
+func (it *FrameIterator) Len() int {
+	return len(it.keys)
+}
+
+// Next возвращает следующий кадр, io.EOF после последнего кадра
+// или ошибку загрузки
+func (it *FrameIterator) Next(ctx context.Context) (models.Frame, error) {
+	select {
+	case <-ctx.Done():
+		return models.Frame{}, ctx.Err()
+	case res, ok := <-it.frames:
+		if !ok {
+			return models.Frame{}, io.EOF
+		}
+		return res.frame, res.err
+	}
+}
+
+// Close останавливает фоновую загрузку кадров
+func (it *FrameIterator) Close() {
+	it.cancel()
+}
+
+func (it *FrameIterator) fetch(ctx context.Context, c *Client, bucket string) {
+	defer close(it.frames)
+
+	for _, idx := range it.order {
+		data, attempts, err := c.downloadWithRetries(ctx, bucket, it.keys[idx])
+		if ctx.Err() != nil {
+			return
+		}
+		res := frameResult{frame: models.Frame{Index: idx, Data: data}}
+		if err != nil {
+			// Один недоступный кадр не останавливает сценарий, его можно обработать позже через reprocess_failed
+			res.err = &models.FrameError{Index: idx, Attempts: attempts, Err: err}
+		}
+
+		select {
+		case it.frames <- res:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// downloadWithRetries скачивает кадр, повторяя неудачные попытки с удвоением паузы.
+// Возвращает число сделанных попыток
+func (c *Client) downloadWithRetries(ctx context.Context, bucket, key string) ([]byte, int, error) {
+	delay := downloadRetryDelay
+	for attempt := 1; ; attempt++ {
+		data, err := c.downloadObject(ctx, bucket, key)
+		if err == nil || attempt == downloadRetries {
+			return data, attempt, err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) downloadObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	obj, err := c.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	return data, nil
+}
+
+// listFrameKeys возвращает ключи кадров, упорядоченные по номеру кадра
+func (c *Client) listFrameKeys(ctx context.Context, bucket, folder string) ([]string, error) {
+	objectCh := c.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    folder,
+		Recursive: true,
+	})
+
+	var keys []string
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, fmt.Errorf("error listing objects: %w", object.Err)
+		}
+
+		// Пропускаем саму папку (если она есть в списке)
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+
+		keys = append(keys, object.Key)
+	}
+
+	sortFrameKeys(keys)
+
+	return keys, nil
+}
+
+// sortFrameKeys упорядочивает ключи кадров. Лексикографический порядок ломается после frame_9999.jpg,
+// поэтому сортируем по числовому суффиксу имени файла
+func sortFrameKeys(keys []string) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		ni, okI := frameNumber(keys[i])
+		nj, okJ := frameNumber(keys[j])
+		if okI && okJ && ni != nj {
+			return ni < nj
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+// frameNumber извлекает номер кадра из ключа вида prefix/frame_0001.jpg
+func frameNumber(key string) (int, bool) {
+	name := strings.TrimSuffix(path.Base(key), path.Ext(key))
+	end := len(name)
+	begin := end
+	for begin > 0 && name[begin-1] >= '0' && name[begin-1] <= '9' {
+		begin--
+	}
+	if begin == end {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(name[begin:end])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseFolderURL(fileURL string) (string, string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid frames location %q, expected bucket/prefix", fileURL)
+	}
+
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFrameNumber(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+		ok   bool
+	}{
+		{key: "frames/id/frame_0001.jpg", want: 1, ok: true},
+		{key: "frames/id/frame_12345.jpg", want: 12345, ok: true},
+		{key: "frames/id/0042.png", want: 42, ok: true},
+		{key: "frames/id/frame_7", want: 7, ok: true},
+		// Цифры в папке не являются номером кадра
+		{key: "frames/2024/frame.jpg", ok: false},
+		{key: "frames/id/", ok: false},
+		{key: "frames/id/frame_99999999999999999999.jpg", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := frameNumber(tt.key)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("frameNumber(%q) = %d, %v, want %d, %v", tt.key, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFrameKeyOrder(t *testing.T) {
+	keys := []string{
+		"frames/id/frame_10000.jpg",
+		"frames/id/frame_9999.jpg",
+		"frames/id/meta.json",
+		"frames/id/frame_0002.jpg",
+		"frames/id/frame_10.jpg",
+	}
+	sortFrameKeys(keys)
+
+	want := []string{
+		"frames/id/frame_0002.jpg",
+		"frames/id/frame_10.jpg",
+		"frames/id/frame_9999.jpg",
+		"frames/id/frame_10000.jpg",
+		"frames/id/meta.json",
+	}
+	if !slices.Equal(keys, want) {
+		t.Errorf("got %v, want %v", keys, want)
+	}
+}
@@ -5,9 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/url"
-	"strings"
 
 	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
 	"github.com/minio/minio-go/v7"
@@ -30,59 +27,10 @@ func NewMinioClient(endpoint, accessKey, secretKey string) (*Client, error) {
 	return &Client{client: client}, nil
 }
 
-func (c *Client) DownloadFilesFromURL(ctx context.Context, fileURL string) ([][]byte, error) {
-	u, err := url.Parse(fileURL)
-	if err != nil {
-		return nil, err
-	}
-
-	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
-	if len(parts) != 2 {
-		return nil, err
-	}
-	bucket, folder := parts[0], parts[1]
-
-	objectCh := c.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
-		Prefix:    folder,
-		Recursive: true,
-	})
-
-	var files [][]byte
-
-	// Обрабатываем каждый объект
-	for object := range objectCh {
-		if object.Err != nil {
-			return nil, object.Err
-		}
-
-		// Пропускаем саму папку (если она есть в списке)
-		if strings.HasSuffix(object.Key, "/") {
-			continue
-		}
-
-		// Получаем объект
-		obj, err := c.client.GetObject(ctx, bucket, object.Key, minio.GetObjectOptions{})
-		if err != nil {
-			return nil, err
-		}
-
-		// Читаем содержимое файла
-		buf := new(bytes.Buffer)
-		_, err = io.Copy(buf, obj)
-		obj.Close()
-		if err != nil {
-			return nil, err
-		}
-
-		files = append(files, buf.Bytes())
-	}
-
-	return files, nil
-}
-
 // SaveDetectionResults сохраняет результаты детекции в бакет predictions
-// в папку с именем сценария под именем файла - индексом файла
-func (c *Client) SaveDetectionResults(ctx context.Context, scenarioID string, fileIndex int, detections []models.Detection) error {
+// в папку с именем сценария под именем файла - индексом файла.
+// Результаты повторных прогонов (version > 0) пишутся во вложенную папку v<version>
+func (c *Client) SaveDetectionResults(ctx context.Context, scenarioID string, version, fileIndex int, detections []models.Detection) error {
 	// Конвертируем детекции в JSON
 	jsonData, err := json.Marshal(detections)
 	if err != nil {
@@ -91,6 +39,9 @@ func (c *Client) SaveDetectionResults(ctx context.Context, scenarioID string, fi
 
 	// Формируем путь для сохранения
 	objectPath := fmt.Sprintf("%s/%d.json", scenarioID, fileIndex)
+	if version > 0 {
+		objectPath = fmt.Sprintf("%s/v%d/%d.json", scenarioID, version, fileIndex)
+	}
 
 	// Загружаем данные в MinIO
 	_, err = c.client.PutObject(
@@ -109,26 +60,3 @@ func (c *Client) SaveDetectionResults(ctx context.Context, scenarioID string, fi
 
 	return nil
 }
-
-// CountFilesInFolder возвращает количество файлов в указанной папке бакета predictions
-func (c *Client) CountFilesInFolder(ctx context.Context, folderPath string) (int, error) {
-	count := 0
-	objectCh := c.client.ListObjects(ctx, "predictions", minio.ListObjectsOptions{
-		Prefix:    folderPath,
-		Recursive: true,
-	})
-
-	for object := range objectCh {
-		if object.Err != nil {
-			return 0, fmt.Errorf("error listing objects: %w", object.Err)
-		}
-
-		if strings.HasSuffix(object.Key, "/") {
-			continue
-		}
-
-		count++
-	}
-
-	return count, nil
-}
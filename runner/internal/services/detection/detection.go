@@ -20,8 +20,8 @@ func NewClient(baseURL string) *Client {
 	return &Client{URL: baseURL}
 }
 
-// SendFrame отправляет изображение JPEG байтами на /predict и возвращает детекции
-func (c *Client) SendFrame(imageData []byte, scenarioID string) ([]models.Detection, error) {
+// SendFrame отправляет изображение JPEG байтами на /predict и возвращает детекции вместе с моделью
+func (c *Client) SendFrame(imageData []byte, scenarioID string) (models.DetectionResponse, error) {
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
 
@@ -32,43 +32,40 @@ func (c *Client) SendFrame(imageData []byte, scenarioID string) ([]models.Detect
 
 	part, err := writer.CreatePart(h)
 	if err != nil {
-		return nil, fmt.Errorf("create form part: %w", err)
+		return models.DetectionResponse{}, fmt.Errorf("create form part: %w", err)
 	}
 
 	if _, err := part.Write(imageData); err != nil {
-		return nil, fmt.Errorf("write image data: %w", err)
+		return models.DetectionResponse{}, fmt.Errorf("write image data: %w", err)
 	}
 
 	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("close writer: %w", err)
+		return models.DetectionResponse{}, fmt.Errorf("close writer: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", c.URL+"/predict", &buf)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return models.DetectionResponse{}, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return models.DetectionResponse{}, fmt.Errorf("http request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("bad status: %s, error: %s", resp.Status, bodyBytes)
+		return models.DetectionResponse{}, fmt.Errorf("bad status: %s, error: %s", resp.Status, bodyBytes)
 	}
 
 	// Обрабатываем JSON-ответ
-	var response struct {
-		Detections []models.Detection `json:"detections"`
-	}
-
+	var response models.DetectionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+		return models.DetectionResponse{}, fmt.Errorf("decode response: %w", err)
 	}
 
 	//log.Printf("Detection[%s]: success (%s), found %d objects", scenarioID, resp.Status, len(response.Detections))
-	return response.Detections, nil
+	return response, nil
 }
@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+)
+
+// ffmpegReader декодирует поток через ffmpeg и читает из stdout последовательность JPEG кадров
+func ffmpegReader(sourceURL string, sampleFPS float64) reader {
+	return func(ctx context.Context, emit func(data []byte)) error {
+		args := []string{"-hide_banner", "-loglevel", "error", "-rtsp_transport", "tcp", "-i", sourceURL}
+		if sampleFPS > 0 {
+			args = append(args, "-vf", "fps="+strconv.FormatFloat(sampleFPS, 'f', -1, 64))
+		}
+		args = append(args, "-f", "image2pipe", "-c:v", "mjpeg", "-q:v", "2", "pipe:1")
+
+		cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return fmt.Errorf("ffmpeg stdout: %w", err)
+		}
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("ffmpeg start: %w", err)
+		}
+
+		readErr := readJPEGs(stdout, emit)
+		waitErr := cmd.Wait()
+		if waitErr != nil {
+			return fmt.Errorf("ffmpeg failed: %w, stderr: %s", waitErr, stderr.String())
+		}
+		return fmt.Errorf("ffmpeg stream ended: %w", readErr)
+	}
+}
+
+// readJPEGs делит поток image2pipe на отдельные JPEG по маркерам SOI (FFD8) и EOI (FFD9).
+// Внутри сжатых данных JPEG байт 0xFF всегда экранируется, поэтому EOI однозначно завершает кадр
+func readJPEGs(r io.Reader, emit func(data []byte)) error {
+	br := bufio.NewReaderSize(r, 1<<16)
+
+	var frame bytes.Buffer
+	var prev byte
+	inFrame := false
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if !inFrame {
+			if prev == 0xFF && b == 0xD8 {
+				inFrame = true
+				frame.Reset()
+				frame.Write([]byte{0xFF, 0xD8})
+				b = 0
+			}
+			prev = b
+			continue
+		}
+
+		frame.WriteByte(b)
+		if prev == 0xFF && b == 0xD9 {
+			emit(bytes.Clone(frame.Bytes()))
+			inFrame = false
+			b = 0
+		}
+		prev = b
+	}
+}
@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// mjpegReader читает HTTP поток multipart/x-mixed-replace, где каждая часть - JPEG кадр
+func mjpegReader(sourceURL string, sampleFPS float64) reader {
+	return func(ctx context.Context, emit func(data []byte)) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("http request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("bad status: %s", resp.Status)
+		}
+
+		mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err != nil {
+			return fmt.Errorf("parse content type: %w", err)
+		}
+		if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+			return fmt.Errorf("not an MJPEG stream: %s", mediaType)
+		}
+
+		// Некоторые камеры указывают boundary сразу с префиксом "--"
+		parts := multipart.NewReader(resp.Body, strings.TrimPrefix(params["boundary"], "--"))
+		sampler := newSampler(sampleFPS)
+		for {
+			part, err := parts.NextPart()
+			if err != nil {
+				return fmt.Errorf("read part: %w", err)
+			}
+
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return fmt.Errorf("read frame: %w", err)
+			}
+
+			if sampler.take() {
+				emit(data)
+			}
+		}
+	}
+}
+
+// sampler пропускает не больше fps кадров в секунду
+type sampler struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func newSampler(fps float64) *sampler {
+	s := &sampler{}
+	if fps > 0 {
+		s.interval = time.Duration(float64(time.Second) / fps)
+	}
+	return s
+}
+
+func (s *sampler) take() bool {
+	now := time.Now()
+	if now.Sub(s.last) < s.interval {
+		return false
+	}
+	s.last = now
+	return true
+}
@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/Capitan-Parrot/distributed-video-system/runner/internal/models"
+)
+
+const reconnectDelay = 5 * time.Second
+
+// reader читает кадры из потока до первой ошибки и передаёт их в emit
+type reader func(ctx context.Context, emit func(data []byte)) error
+
+// Source бесконечный источник кадров живого потока. При обрыве соединения
+// переподключается, пока не будет вызван Close или не отменён контекст
+type Source struct {
+	url    string
+	frames chan models.Frame
+	cancel context.CancelFunc
+}
+
+// IsStreamURL сообщает, является ли video_source адресом живого потока
+func IsStreamURL(source string) bool {
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "rtsp", "rtsps", "http", "https":
+		return true
+	default:
+		return false
+	}
+}
+
+// Open подключается к rtsp:// (через ffmpeg) или http(s):// MJPEG потоку.
+// Кадры нумеруются подряд, начиная с start, и прореживаются до sampleFPS кадров в секунду
+func Open(ctx context.Context, sourceURL string, start int, sampleFPS float64) (*Source, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var read reader
+	switch u.Scheme {
+	case "rtsp", "rtsps":
+		read = ffmpegReader(sourceURL, sampleFPS)
+	case "http", "https":
+		read = mjpegReader(sourceURL, sampleFPS)
+	default:
+		return nil, fmt.Errorf("unsupported stream scheme %q", u.Scheme)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Source{
+		url:    sourceURL,
+		frames: make(chan models.Frame, 1),
+		cancel: cancel,
+	}
+
+	go s.run(ctx, read, start)
+
+	return s, nil
+}
+
+// Next возвращает следующий кадр потока
+func (s *Source) Next(ctx context.Context) (models.Frame, error) {
+	select {
+	case <-ctx.Done():
+		return models.Frame{}, ctx.Err()
+	case frame, ok := <-s.frames:
+		if !ok {
+			return models.Frame{}, io.EOF
+		}
+		return frame, nil
+	}
+}
+
+// Close отключается от потока
+func (s *Source) Close() {
+	s.cancel()
+}
+
+func (s *Source) run(ctx context.Context, read reader, next int) {
+	defer close(s.frames)
+
+	dropped := 0
+	emit := func(data []byte) {
+		select {
+		case s.frames <- models.Frame{Index: next, Data: data, Timestamp: time.Now().UTC()}:
+			next++
+		default:
+			// Обработка не успевает за потоком: живой кадр лучше пропустить, чем копить задержку
+			dropped++
+			if dropped%100 == 1 {
+				log.Printf("Stream %s: processing is behind, %d frames dropped", s.url, dropped)
+			}
+		}
+	}
+
+	for {
+		err := read(ctx, emit)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Stream %s: %v, reconnecting in %v", s.url, err, reconnectDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReadJPEGs(t *testing.T) {
+	first := []byte{0xFF, 0xD8, 0x01, 0xFF, 0x00, 0x02, 0xFF, 0xD9}
+	second := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	var input []byte
+	// Мусор до первого кадра и между кадрами пропускается
+	input = append(input, 0x00, 0xFF, 0x13)
+	input = append(input, first...)
+	input = append(input, 0x42)
+	input = append(input, second...)
+	// Незавершённый кадр в конце потока не отдаётся
+	input = append(input, 0xFF, 0xD8, 0x03)
+
+	var frames [][]byte
+	err := readJPEGs(bytes.NewReader(input), func(data []byte) {
+		frames = append(frames, data)
+	})
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("got error %v, want EOF", err)
+	}
+	if len(frames) != 2 || !bytes.Equal(frames[0], first) || !bytes.Equal(frames[1], second) {
+		t.Errorf("got frames %x, want %x and %x", frames, first, second)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	// Без ограничения проходит каждый кадр
+	s := newSampler(0)
+	for i := 0; i < 3; i++ {
+		if !s.take() {
+			t.Fatal("sampler without fps skipped a frame")
+		}
+	}
+
+	s = newSampler(1)
+	if !s.take() {
+		t.Fatal("first frame was skipped")
+	}
+	if s.take() {
+		t.Error("second frame within the interval was taken")
+	}
+	s.last = s.last.Add(-time.Second)
+	if !s.take() {
+		t.Error("frame after the interval was skipped")
+	}
+}